@@ -202,6 +202,65 @@ func (s *StateDB) Error() error {
 	return s.dbErr
 }
 
+// TimingSnapshot holds the measurements gathered by a StateDB at one point in
+// time.
+type TimingSnapshot struct {
+	AccountReads         time.Duration
+	AccountHashes        time.Duration
+	AccountUpdates       time.Duration
+	AccountCommits       time.Duration
+	StorageReads         time.Duration
+	StorageHashes        time.Duration
+	StorageUpdates       time.Duration
+	StorageCommits       time.Duration
+	SnapshotAccountReads time.Duration
+	SnapshotStorageReads time.Duration
+	SnapshotCommits      time.Duration
+}
+
+// String implements fmt.Stringer.
+func (t TimingSnapshot) String() string {
+	return fmt.Sprintf("accountReads=%v accountHashes=%v accountUpdates=%v accountCommits=%v "+
+		"storageReads=%v storageHashes=%v storageUpdates=%v storageCommits=%v "+
+		"snapshotAccountReads=%v snapshotStorageReads=%v snapshotCommits=%v",
+		t.AccountReads, t.AccountHashes, t.AccountUpdates, t.AccountCommits,
+		t.StorageReads, t.StorageHashes, t.StorageUpdates, t.StorageCommits,
+		t.SnapshotAccountReads, t.SnapshotStorageReads, t.SnapshotCommits)
+}
+
+// Timings returns a snapshot of the measurements gathered during execution.
+func (s *StateDB) Timings() TimingSnapshot {
+	return TimingSnapshot{
+		AccountReads:         s.AccountReads,
+		AccountHashes:        s.AccountHashes,
+		AccountUpdates:       s.AccountUpdates,
+		AccountCommits:       s.AccountCommits,
+		StorageReads:         s.StorageReads,
+		StorageHashes:        s.StorageHashes,
+		StorageUpdates:       s.StorageUpdates,
+		StorageCommits:       s.StorageCommits,
+		SnapshotAccountReads: s.SnapshotAccountReads,
+		SnapshotStorageReads: s.SnapshotStorageReads,
+		SnapshotCommits:      s.SnapshotCommits,
+	}
+}
+
+// ResetMetrics zeroes the measurements gathered during execution, e.g. to
+// attribute them to individual blocks.
+func (s *StateDB) ResetMetrics() {
+	s.AccountReads = 0
+	s.AccountHashes = 0
+	s.AccountUpdates = 0
+	s.AccountCommits = 0
+	s.StorageReads = 0
+	s.StorageHashes = 0
+	s.StorageUpdates = 0
+	s.StorageCommits = 0
+	s.SnapshotAccountReads = 0
+	s.SnapshotStorageReads = 0
+	s.SnapshotCommits = 0
+}
+
 func (s *StateDB) AddLog(log *types.Log) {
 	s.journal.append(addLogChange{txhash: s.thash})
 
@@ -689,7 +748,8 @@ func (db *StateDB) ForEachStorage(addr common.Address, cb func(key, value common
 // Copy creates a deep, independent copy of the state.
 // Snapshots of the copied state cannot be applied to the copy.
 func (s *StateDB) Copy() *StateDB {
-	// Copy all the basic fields, initialize the memory ones
+	// Copy all the basic fields, initialize the memory ones. Measurements
+	// are not carried over, the copy starts with zeroed timings.
 	state := &StateDB{
 		db:                  s.db,
 		trie:                s.db.CopyTrie(s.trie),
@@ -28,6 +28,7 @@ import (
 	"sync"
 	"testing"
 	"testing/quick"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -503,6 +504,108 @@ func TestCopyOfCopy(t *testing.T) {
 	}
 }
 
+// setMeasurements sets the measurements of a state to distinct values, from
+// 1ns for AccountReads to 11ns for SnapshotCommits in declaration order.
+func setMeasurements(state *StateDB) {
+	state.AccountReads = 1
+	state.AccountHashes = 2
+	state.AccountUpdates = 3
+	state.AccountCommits = 4
+	state.StorageReads = 5
+	state.StorageHashes = 6
+	state.StorageUpdates = 7
+	state.StorageCommits = 8
+	state.SnapshotAccountReads = 9
+	state.SnapshotStorageReads = 10
+	state.SnapshotCommits = 11
+}
+
+// TestCopyMeasurements tests that the measurements of a state are not carried
+// over to its copy.
+func TestCopyMeasurements(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	addr := common.HexToAddress("aaaa")
+	state.SetBalance(addr, big.NewInt(42))
+
+	setMeasurements(state)
+
+	cpy := state.Copy()
+	measurements := []time.Duration{
+		cpy.AccountReads, cpy.AccountHashes, cpy.AccountUpdates, cpy.AccountCommits,
+		cpy.StorageReads, cpy.StorageHashes, cpy.StorageUpdates, cpy.StorageCommits,
+		cpy.SnapshotAccountReads, cpy.SnapshotStorageReads, cpy.SnapshotCommits,
+	}
+	for i, m := range measurements {
+		if m != 0 {
+			t.Errorf("measurement %d not reset in copy: %v", i, m)
+		}
+	}
+	if got := cpy.GetBalance(addr).Uint64(); got != 42 {
+		t.Fatalf("copy fail, expected 42, got %v", got)
+	}
+	if state.SnapshotCommits != 11 {
+		t.Fatalf("original measurements modified by copy")
+	}
+}
+
+// TestResetMetrics tests that resetting the metrics zeroes all measurements.
+func TestResetMetrics(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	setMeasurements(state)
+
+	state.ResetMetrics()
+	measurements := []time.Duration{
+		state.AccountReads, state.AccountHashes, state.AccountUpdates, state.AccountCommits,
+		state.StorageReads, state.StorageHashes, state.StorageUpdates, state.StorageCommits,
+		state.SnapshotAccountReads, state.SnapshotStorageReads, state.SnapshotCommits,
+	}
+	for i, m := range measurements {
+		if m != 0 {
+			t.Errorf("measurement %d not reset: %v", i, m)
+		}
+	}
+}
+
+// TestTimings tests that the timing snapshot reflects the measurements of a
+// state.
+func TestTimings(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	setMeasurements(state)
+
+	want := TimingSnapshot{
+		AccountReads:         1,
+		AccountHashes:        2,
+		AccountUpdates:       3,
+		AccountCommits:       4,
+		StorageReads:         5,
+		StorageHashes:        6,
+		StorageUpdates:       7,
+		StorageCommits:       8,
+		SnapshotAccountReads: 9,
+		SnapshotStorageReads: 10,
+		SnapshotCommits:      11,
+	}
+	if have := state.Timings(); have != want {
+		t.Fatalf("timing snapshot mismatch: have %v, want %v", have, want)
+	}
+	wantStr := "accountReads=1ns accountHashes=2ns accountUpdates=3ns accountCommits=4ns " +
+		"storageReads=5ns storageHashes=6ns storageUpdates=7ns storageCommits=8ns " +
+		"snapshotAccountReads=9ns snapshotStorageReads=10ns snapshotCommits=11ns"
+	if have := want.String(); have != wantStr {
+		t.Errorf("string mismatch: have %q, want %q", have, wantStr)
+	}
+
+	// the snapshot must not change with the state
+	snapshot := state.Timings()
+	state.ResetMetrics()
+	if snapshot != want {
+		t.Errorf("snapshot changed after reset: have %v, want %v", snapshot, want)
+	}
+	if have := state.Timings(); have != (TimingSnapshot{}) {
+		t.Errorf("timing snapshot not reset: %v", have)
+	}
+}
+
 // Tests a regression where committing a copy lost some internal meta information,
 // leading to corrupted subsequent copies.
 //
@@ -17,11 +17,15 @@
 package vm
 
 import (
-	"context"
 	"database/sql"
+	"encoding/csv"
 	_ "github.com/mattn/go-sqlite3"
+	"io"
 	"log"
 	"encoding/hex"
+	"sort"
+	"strconv"
+	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -29,9 +33,12 @@ import (
 // Basic-block profiling flag controlled by cli
 var BasicBlockProfiling bool
 
-// Maximal number of records per SQLITE3 transaction for writing
+// Default maximal number of records per SQLITE3 transaction for writing
 const BasicBlockMaxNumRecords = 1000
 
+// Maximal number of records per SQLITE3 transaction for writing
+var BasicBlockProfilingBatchSize int = BasicBlockMaxNumRecords
+
 // Buffer size for micro-profiling channel
 var BasicBlockProfilingBufferSize int
 
@@ -51,6 +58,14 @@ type BasicBlockKey struct {
 	Address      uint   // basic-block start address
 }
 
+// Per-contract rollup of a basic-block statistic
+type BasicBlockContractSummary struct {
+	Contract     string // contract in hex format
+	BasicBlocks  int    // number of distinct basic blocks
+	Frequency    uint64 // accumulated basic-block executions
+	Instructions uint64 // accumulated executed instructions
+}
+
 // Basic-block statistic
 type BasicBlockProfileStatistic struct {
 	basicBlockFrequency map[BasicBlockKey]uint64 // basic block statistics
@@ -59,6 +74,9 @@ type BasicBlockProfileStatistic struct {
 // Basic-Block Profiling channel
 var bbpChannel chan *BasicBlockProfileData = make(chan *BasicBlockProfileData, BasicBlockProfilingBufferSize)
 
+// Number of producers blocked on a full basic-block profiling channel
+var bbpBlocked uint64
+
 // Create new micro-profiling statistic
 func NewBasicBlockProfileStatistic() *BasicBlockProfileStatistic {
 	p := new(BasicBlockProfileStatistic)
@@ -66,32 +84,64 @@ func NewBasicBlockProfileStatistic() *BasicBlockProfileStatistic {
 	return p
 }
 
-// The data collector checks for a stopping signal and processes
-// the workers' records via a channel. A data collector is a background task.
-func BasicBlockProfilingCollector(ctx context.Context, done chan struct{}, bbps *BasicBlockProfileStatistic) {
+// The data collector processes the workers' records via a channel until
+// the channel is closed by StopBasicBlockProfiling. A data collector is a
+// background task. Every record sent before the channel is closed is
+// processed before done is closed.
+func BasicBlockProfilingCollector(done chan struct{}, bbps *BasicBlockProfileStatistic) {
 	defer close(done)
-	for {
-		select {
-
-		// receive a new data record from a worker?
-		case bbpd := <-bbpChannel:
-			for addr, bb := range bbpd.BasicBlockFrequency {
-				bkey := BasicBlockKey{Contract: bbpd.Contract.String(), Address: addr, Instructions: hex.EncodeToString(bb.Instructions)}
-				bbps.basicBlockFrequency[bkey] += bb.Frequency
-			}
+	for bbpd := range bbpChannel {
+		bbps.update(bbpd)
+	}
+}
 
-		// receive stop signal?
-		case <-ctx.Done():
-			if len(bbpChannel) == 0 {
-				return
-			}
-		}
+// InitBasicBlockProfiling (re)creates the basic-block profiling channel with
+// the given buffer size and resets the count of blocked producers. It must be
+// called before workers and collectors are started.
+func InitBasicBlockProfiling(bufferSize int) {
+	BasicBlockProfilingBufferSize = bufferSize
+	bbpChannel = make(chan *BasicBlockProfileData, bufferSize)
+	atomic.StoreUint64(&bbpBlocked, 0)
+}
+
+// StopBasicBlockProfiling closes the basic-block profiling channel to signal
+// the collectors that all workers have finished. It must be called after the
+// last record has been produced; before profiling is restarted, the channel
+// has to be recreated with InitBasicBlockProfiling.
+func StopBasicBlockProfiling() {
+	close(bbpChannel)
+}
+
+// update the statistic with a data record of a worker
+func (bbps *BasicBlockProfileStatistic) update(bbpd *BasicBlockProfileData) {
+	for addr, bb := range bbpd.BasicBlockFrequency {
+		bkey := BasicBlockKey{Contract: bbpd.Contract.String(), Address: addr, Instructions: hex.EncodeToString(bb.Instructions)}
+		bbps.basicBlockFrequency[bkey] += bb.Frequency
 	}
 }
 
-// put micro profiling data into the processing queue
+// put basic-block profiling data into the processing queue; if the queue
+// is full, the producer blocks and the event is counted
 func ProcessBasicBlockProfileData(bbpd *BasicBlockProfileData) {
-	bbpChannel <- bbpd
+	select {
+	case bbpChannel <- bbpd:
+	default:
+		atomic.AddUint64(&bbpBlocked, 1)
+		bbpChannel <- bbpd
+	}
+}
+
+// BasicBlockProfilingBlocked returns how often a producer found the
+// basic-block profiling queue full and had to wait for a collector since the
+// last InitBasicBlockProfiling
+func BasicBlockProfilingBlocked() uint64 {
+	return atomic.LoadUint64(&bbpBlocked)
+}
+
+// BasicBlockProfilingQueueDepth returns the number of records waiting in
+// the basic-block profiling queue
+func BasicBlockProfilingQueueDepth() int {
+	return len(bbpChannel)
 }
 
 // Merge two basic-block profiling statistics
@@ -151,7 +201,7 @@ func (bbps *BasicBlockProfileStatistic) Dump() {
 	ctr := 1
 	for bkey, freq := range bbps.basicBlockFrequency {
 		// commit dataset when record threshold is reached
-		if ctr >= BasicBlockMaxNumRecords {
+		if ctr >= BasicBlockProfilingBatchSize {
 			ctr = 1
 			_, err = db.Exec("END TRANSACTION; BEGIN TRANSACTION;")
 			if err != nil {
@@ -172,4 +222,140 @@ func (bbps *BasicBlockProfileStatistic) Dump() {
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
+
+	// dump per-contract summary
+	bbps.dumpContractSummary(db)
+}
+
+// ContractSummary aggregates the basic blocks of each contract into its
+// total number of block executions and executed instructions. The summary
+// is sorted by descending number of executed instructions.
+func (bbps *BasicBlockProfileStatistic) ContractSummary() []BasicBlockContractSummary {
+	contracts := make(map[string]*BasicBlockContractSummary)
+	for bkey, freq := range bbps.basicBlockFrequency {
+		s, ok := contracts[bkey.Contract]
+		if !ok {
+			s = &BasicBlockContractSummary{Contract: bkey.Contract}
+			contracts[bkey.Contract] = s
+		}
+		s.BasicBlocks++
+		s.Frequency += freq
+		// instructions are hex encoded with one byte per instruction
+		s.Instructions += freq * uint64(len(bkey.Instructions)/2)
+	}
+	summary := make([]BasicBlockContractSummary, 0, len(contracts))
+	for _, s := range contracts {
+		summary = append(summary, *s)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Instructions != summary[j].Instructions {
+			return summary[i].Instructions > summary[j].Instructions
+		}
+		return summary[i].Contract < summary[j].Contract
+	})
+	return summary
+}
+
+// dump per-contract summary into a SQLITE3 database
+func (bbps *BasicBlockProfileStatistic) dumpContractSummary(db *sql.DB) {
+	// drop old summary table and create new one
+	_, err := db.Exec("DROP TABLE IF EXISTS BasicBlockContract;CREATE TABLE BasicBlockContract ( contract TEXT, blocks NUMERIC, frequency NUMERIC, instructions NUMERIC );")
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	_, err = db.Exec("BEGIN TRANSACTION")
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	// prepare an insert statement for faster inserts and insert summaries
+	statement, err := db.Prepare("INSERT INTO BasicBlockContract(contract, blocks, frequency, instructions) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	for _, s := range bbps.ContractSummary() {
+		_, err = statement.Exec(s.Contract, s.BasicBlocks, s.Frequency, s.Instructions)
+		if err != nil {
+			log.Fatalln(err.Error())
+		}
+	}
+
+	_, err = db.Exec("END TRANSACTION;")
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+}
+
+// return basic-block keys of a statistic sorted by contract, address, and
+// instructions
+func (bbps *BasicBlockProfileStatistic) sortedKeys() []BasicBlockKey {
+	keys := make([]BasicBlockKey, 0, len(bbps.basicBlockFrequency))
+	for bkey := range bbps.basicBlockFrequency {
+		keys = append(keys, bkey)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Contract != keys[j].Contract {
+			return keys[i].Contract < keys[j].Contract
+		}
+		if keys[i].Address != keys[j].Address {
+			return keys[i].Address < keys[j].Address
+		}
+		return keys[i].Instructions < keys[j].Instructions
+	})
+	return keys
+}
+
+// dump basic block frequency stats as CSV with the columns of the SQLITE3
+// table; records are sorted by contract and address
+func (bbps *BasicBlockProfileStatistic) DumpCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"contract", "address", "instructions", "frequency"}); err != nil {
+		return err
+	}
+	for _, bkey := range bbps.sortedKeys() {
+		record := []string{
+			bkey.Contract,
+			strconv.FormatUint(uint64(bkey.Address), 10),
+			bkey.Instructions,
+			strconv.FormatUint(bbps.basicBlockFrequency[bkey], 10),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// load basic block frequency stats from a SQLITE3 database written by Dump
+// so that it can be merged with the statistic of another run
+func LoadBasicBlockProfileStatistic(path string) (*BasicBlockProfileStatistic, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT contract, address, instructions, frequency FROM BasicBlockFrequency")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bbps := NewBasicBlockProfileStatistic()
+	for rows.Next() {
+		var (
+			bkey BasicBlockKey
+			freq uint64
+		)
+		if err := rows.Scan(&bkey.Contract, &bkey.Address, &bkey.Instructions, &freq); err != nil {
+			return nil, err
+		}
+		bbps.basicBlockFrequency[bkey] += freq
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return bbps, nil
 }
@@ -0,0 +1,289 @@
+// Copyright 2022 The go-fantom Authors
+// This file is part of the go-fantom library.
+//
+// The go-fantom library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// basicBlockProfilingTestDB points BasicBlockProfilingDB to a fresh database
+// in a temporary directory and returns a cleanup function restoring it.
+func basicBlockProfilingTestDB(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "basicblockprofiling")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	oldDB := BasicBlockProfilingDB
+	BasicBlockProfilingDB = filepath.Join(dir, "basicblockprofiling.db")
+	return BasicBlockProfilingDB, func() {
+		BasicBlockProfilingDB = oldDB
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBasicBlockProfileDumpBatches(t *testing.T) {
+	path, cleanup := basicBlockProfilingTestDB(t)
+	defer cleanup()
+
+	oldBatchSize := BasicBlockProfilingBatchSize
+	BasicBlockProfilingBatchSize = 7
+	defer func() { BasicBlockProfilingBatchSize = oldBatchSize }()
+
+	// dump several batches worth of records plus a partial batch
+	const numRecords = 7*3 + 2
+	bbps := NewBasicBlockProfileStatistic()
+	for i := 0; i < numRecords; i++ {
+		bkey := BasicBlockKey{Contract: "0x01", Instructions: "5b00", Address: uint(i)}
+		bbps.basicBlockFrequency[bkey] = uint64(i + 1)
+	}
+	bbps.Dump()
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		count int
+		total uint64
+	)
+	if err := db.QueryRow("SELECT COUNT(*), SUM(frequency) FROM BasicBlockFrequency").Scan(&count, &total); err != nil {
+		t.Fatalf("failed to query basic-block frequency: %v", err)
+	}
+	if count != numRecords {
+		t.Errorf("row count mismatch: have %d, want %d", count, numRecords)
+	}
+	if want := uint64(numRecords * (numRecords + 1) / 2); total != want {
+		t.Errorf("frequency sum mismatch: have %d, want %d", total, want)
+	}
+}
+
+// small basic-block statistic over two contracts
+func testBasicBlockProfileStatistic() *BasicBlockProfileStatistic {
+	bbps := NewBasicBlockProfileStatistic()
+	bbps.basicBlockFrequency[BasicBlockKey{Contract: "0x02", Instructions: "5b6001600056", Address: 10}] = 4
+	bbps.basicBlockFrequency[BasicBlockKey{Contract: "0x01", Instructions: "5b00", Address: 7}] = 2
+	bbps.basicBlockFrequency[BasicBlockKey{Contract: "0x01", Instructions: "5b6000f3", Address: 3}] = 9
+	return bbps
+}
+
+func TestBasicBlockProfileDumpCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testBasicBlockProfileStatistic().DumpCSV(&buf); err != nil {
+		t.Fatalf("dump failed: %v", err)
+	}
+	want := "contract,address,instructions,frequency\n" +
+		"0x01,3,5b6000f3,9\n" +
+		"0x01,7,5b00,2\n" +
+		"0x02,10,5b6001600056,4\n"
+	if have := buf.String(); have != want {
+		t.Errorf("output mismatch:\nhave:\n%s\nwant:\n%s", have, want)
+	}
+}
+
+func TestBasicBlockProfileContractSummary(t *testing.T) {
+	path, cleanup := basicBlockProfilingTestDB(t)
+	defer cleanup()
+
+	bbps := testBasicBlockProfileStatistic()
+	want := []BasicBlockContractSummary{
+		{Contract: "0x01", BasicBlocks: 2, Frequency: 11, Instructions: 2*2 + 9*4},
+		{Contract: "0x02", BasicBlocks: 1, Frequency: 4, Instructions: 4 * 6},
+	}
+	if have := bbps.ContractSummary(); !reflect.DeepEqual(have, want) {
+		t.Fatalf("summary mismatch: have %v, want %v", have, want)
+	}
+
+	bbps.Dump()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT contract, blocks, frequency, instructions FROM BasicBlockContract ORDER BY rowid")
+	if err != nil {
+		t.Fatalf("failed to query contract summary: %v", err)
+	}
+	defer rows.Close()
+
+	var have []BasicBlockContractSummary
+	for rows.Next() {
+		var s BasicBlockContractSummary
+		if err := rows.Scan(&s.Contract, &s.BasicBlocks, &s.Frequency, &s.Instructions); err != nil {
+			t.Fatalf("failed to scan contract summary: %v", err)
+		}
+		have = append(have, s)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("dumped summary mismatch: have %v, want %v", have, want)
+	}
+}
+
+func TestBasicBlockProfileLoadAndMerge(t *testing.T) {
+	path, cleanup := basicBlockProfilingTestDB(t)
+	defer cleanup()
+
+	testBasicBlockProfileStatistic().Dump()
+	loaded, err := LoadBasicBlockProfileStatistic(path)
+	if err != nil {
+		t.Fatalf("failed to load statistic: %v", err)
+	}
+	if want := testBasicBlockProfileStatistic(); !reflect.DeepEqual(loaded, want) {
+		t.Fatalf("loaded statistic mismatch: have %v, want %v", loaded.basicBlockFrequency, want.basicBlockFrequency)
+	}
+
+	// merging the loaded run with a second run doubles every frequency
+	loaded.Merge(testBasicBlockProfileStatistic())
+	for bkey, freq := range testBasicBlockProfileStatistic().basicBlockFrequency {
+		if have := loaded.basicBlockFrequency[bkey]; have != 2*freq {
+			t.Errorf("%v: frequency mismatch: have %d, want %d", bkey, have, 2*freq)
+		}
+	}
+}
+
+func TestBasicBlockProfilingCollectorDrain(t *testing.T) {
+	const numRecords = 50
+
+	// queue all records before the collector runs
+	oldChannel := bbpChannel
+	bbpChannel = make(chan *BasicBlockProfileData, numRecords)
+	defer func() { bbpChannel = oldChannel }()
+	for i := 0; i < numRecords; i++ {
+		ProcessBasicBlockProfileData(&BasicBlockProfileData{
+			Contract: common.BigToAddress(common.Big1),
+			BasicBlockFrequency: map[uint]BasicBlock{
+				uint(i):        {Instructions: []byte{byte(JUMPDEST), byte(STOP)}, Frequency: 1},
+				uint(i + 1000): {Instructions: []byte{byte(JUMPDEST), byte(JUMP)}, Frequency: 2},
+			},
+		})
+	}
+
+	// stop straight away; the collector must still process every record
+	StopBasicBlockProfiling()
+	done := make(chan struct{})
+	bbps := NewBasicBlockProfileStatistic()
+	BasicBlockProfilingCollector(done, bbps)
+	<-done
+
+	if have := len(bbps.basicBlockFrequency); have != 2*numRecords {
+		t.Errorf("basic-block count mismatch: have %d, want %d", have, 2*numRecords)
+	}
+	var total uint64
+	for _, freq := range bbps.basicBlockFrequency {
+		total += freq
+	}
+	if total != 3*numRecords {
+		t.Errorf("frequency sum mismatch: have %d, want %d", total, 3*numRecords)
+	}
+}
+
+func TestInitBasicBlockProfiling(t *testing.T) {
+	oldChannel, oldSize := bbpChannel, BasicBlockProfilingBufferSize
+	defer func() { bbpChannel, BasicBlockProfilingBufferSize = oldChannel, oldSize }()
+
+	for _, size := range []int{0, 1, 1024} {
+		atomic.StoreUint64(&bbpBlocked, 3)
+		InitBasicBlockProfiling(size)
+		if have := BasicBlockProfilingBlocked(); have != 0 {
+			t.Errorf("blocked count not reset: have %d, want 0", have)
+		}
+		if cap(bbpChannel) != size {
+			t.Errorf("channel capacity mismatch: have %d, want %d", cap(bbpChannel), size)
+		}
+		if BasicBlockProfilingBufferSize != size {
+			t.Errorf("buffer size mismatch: have %d, want %d", BasicBlockProfilingBufferSize, size)
+		}
+	}
+}
+
+func TestBasicBlockProfilingCollectorWaitsForStop(t *testing.T) {
+	const numRecords = 10
+
+	oldChannel, oldSize := bbpChannel, BasicBlockProfilingBufferSize
+	defer func() { bbpChannel, BasicBlockProfilingBufferSize = oldChannel, oldSize }()
+	InitBasicBlockProfiling(numRecords)
+
+	done := make(chan struct{})
+	bbps := NewBasicBlockProfileStatistic()
+	go BasicBlockProfilingCollector(done, bbps)
+
+	// let the collector go idle on an empty channel before the worker
+	// produces its records; it must keep running until it is stopped
+	for i := 0; i < numRecords; i++ {
+		select {
+		case <-done:
+			t.Fatalf("collector finished before being stopped")
+		case <-time.After(time.Millisecond):
+		}
+		ProcessBasicBlockProfileData(&BasicBlockProfileData{
+			Contract:            common.BigToAddress(common.Big1),
+			BasicBlockFrequency: map[uint]BasicBlock{uint(i): {Instructions: []byte{byte(STOP)}, Frequency: 1}},
+		})
+	}
+	StopBasicBlockProfiling()
+	<-done
+
+	if have := len(bbps.basicBlockFrequency); have != numRecords {
+		t.Errorf("basic-block count mismatch: have %d, want %d", have, numRecords)
+	}
+}
+
+func TestBasicBlockProfilingBackpressure(t *testing.T) {
+	oldChannel := bbpChannel
+	bbpChannel = make(chan *BasicBlockProfileData, 1)
+	defer func() { bbpChannel = oldChannel }()
+
+	blocked := BasicBlockProfilingBlocked()
+	ProcessBasicBlockProfileData(&BasicBlockProfileData{})
+	if have := BasicBlockProfilingBlocked(); have != blocked {
+		t.Fatalf("blocked counter changed without a full queue: have %d, want %d", have, blocked)
+	}
+	if have := BasicBlockProfilingQueueDepth(); have != 1 {
+		t.Fatalf("queue depth mismatch: have %d, want 1", have)
+	}
+
+	// the queue is full, so the next producer must block
+	done := make(chan struct{})
+	go func() {
+		ProcessBasicBlockProfileData(&BasicBlockProfileData{})
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for BasicBlockProfilingBlocked() != blocked+1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("blocked producer not counted: have %d, want %d", BasicBlockProfilingBlocked(), blocked+1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-bbpChannel
+	<-done
+	if have := BasicBlockProfilingQueueDepth(); have != 1 {
+		t.Errorf("queue depth mismatch: have %d, want 1", have)
+	}
+}
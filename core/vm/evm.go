@@ -129,6 +129,9 @@ type EVM struct {
 	// available gas is calculated in gasCall* according to the 63/64 rule and later
 	// applied in opCall*.
 	callGasTemp uint64
+	// steps counts the instructions executed since the start of the current
+	// top-level call; it is limited by Config.MaxSteps
+	steps int
 	// An optional override to intercept EVM calls.
 	CallContext CallContext
 }
@@ -105,3 +105,62 @@ func TestEIP2200(t *testing.T) {
 		}
 	}
 }
+
+var (
+	petersburgChainConfig = &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+	}
+	istanbulChainConfig = &params.ChainConfig{
+		ChainID:             big.NewInt(1),
+		HomesteadBlock:      big.NewInt(0),
+		EIP150Block:         big.NewInt(0),
+		EIP155Block:         big.NewInt(0),
+		EIP158Block:         big.NewInt(0),
+		ByzantiumBlock:      big.NewInt(0),
+		ConstantinopleBlock: big.NewInt(0),
+		PetersburgBlock:     big.NewInt(0),
+		IstanbulBlock:       big.NewInt(0),
+	}
+)
+
+var sstoreForkTests = []struct {
+	config  *params.ChainConfig
+	gaspool uint64
+	input   string
+	used    uint64
+	failure error
+}{
+	{petersburgChainConfig, math.MaxUint64, "0x6001600055", 20006, nil},           // 0 -> 1, legacy set cost
+	{petersburgChainConfig, math.MaxUint64, "0x6000600055", 5006, nil},            // 0 -> 0, legacy reset cost
+	{istanbulChainConfig, math.MaxUint64, "0x6001600055", 20006, nil},             // 0 -> 1, EIP-2200 set cost
+	{istanbulChainConfig, math.MaxUint64, "0x6000600055", 806, nil},               // 0 -> 0, EIP-2200 no-op cost
+	{istanbulChainConfig, 2306, "0x6001600055", 2306, ErrOutOfGas},                // 0 -> 1, EIP-2200 sentry
+	{istanbulChainConfig, 2307, "0x6000600055", 806, nil},                         // 0 -> 0, EIP-2200 above sentry
+	{petersburgChainConfig, 5005, "0x6000600055", 5005, ErrOutOfGas},              // 0 -> 0, legacy out of gas
+	{petersburgChainConfig, 20006, "0x6001600055", 20006, nil},                    // 0 -> 1, legacy exact gas
+	{istanbulChainConfig, 20006, "0x6001600055", 20006, nil},                      // 0 -> 1, EIP-2200 exact gas
+	{istanbulChainConfig, 20005, "0x6001600055", 20005, ErrOutOfGas},              // 0 -> 1, EIP-2200 out of gas
+	{petersburgChainConfig, math.MaxUint64, "0x60016000556000600055", 25012, nil}, // 0 -> 1 -> 0, legacy
+	{istanbulChainConfig, math.MaxUint64, "0x60016000556000600055", 20812, nil},   // 0 -> 1 -> 0, EIP-2200
+}
+
+// TestSStoreGasPerFork checks that SSTORE is priced with the legacy model
+// before Istanbul and with EIP-2200 (including the sentry) from Istanbul on.
+func TestSStoreGasPerFork(t *testing.T) {
+	for i, tt := range sstoreForkTests {
+		_, gas, err := runTestCode(t, hexutil.MustDecode(tt.input), nil, tt.gaspool, tt.config, Config{})
+		if err != tt.failure {
+			t.Errorf("test %d: failure mismatch: have %v, want %v", i, err, tt.failure)
+		}
+		if used := tt.gaspool - gas; used != tt.used {
+			t.Errorf("test %d: gas used mismatch: have %v, want %v", i, used, tt.used)
+		}
+	}
+}
@@ -558,6 +558,27 @@ func BenchmarkOpMstore(bench *testing.B) {
 	}
 }
 
+func BenchmarkOpMstore8(bench *testing.B) {
+	var (
+		env            = NewEVM(BlockContext{}, TxContext{}, nil, params.TestChainConfig, Config{})
+		stack          = newstack()
+		mem            = NewMemory()
+		evmInterpreter = NewEVMInterpreter(env, env.Config)
+	)
+
+	env.interpreter = evmInterpreter
+	mem.Resize(64)
+	pc := uint64(0)
+	memStart := new(uint256.Int)
+	value := new(uint256.Int).SetUint64(0x37)
+
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		stack.pushN(*value, *memStart)
+		opMstore8(&pc, evmInterpreter, &ScopeContext{mem, stack, nil})
+	}
+}
+
 func BenchmarkOpSHA3(bench *testing.B) {
 	var (
 		env            = NewEVM(BlockContext{}, TxContext{}, nil, params.TestChainConfig, Config{})
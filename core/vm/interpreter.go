@@ -43,6 +43,11 @@ type Config struct {
 	StatePrecompiles map[common.Address]PrecompiledStateContract
 
 	InterpreterImpl string
+
+	// Maximum number of instructions executed by a top-level call including
+	// nested calls (0 or less = unlimited). Only the geth interpreter honours
+	// it; interpreters registered via RegisterInterpreterFactory ignore it.
+	MaxSteps int
 }
 
 // ScopeContext contains the things that are per-call, such as stack and memory,
@@ -237,6 +242,10 @@ func (in *GethEVMInterpreter) runMicroProfiling(state *InterpreterState, input [
 			close(state.done)
 		}
 	}()
+	// A top-level call starts with a fresh step budget
+	if in.evm.Depth == 0 {
+		in.evm.steps = 0
+	}
 	// Increment the call depth which is restricted to 1024
 	in.evm.Depth++
 	defer func() { in.evm.Depth-- }()
@@ -279,7 +288,10 @@ func (in *GethEVMInterpreter) runMicroProfiling(state *InterpreterState, input [
 		res                []byte                       // result of the opcode execution function
 		opCodeFrequency    = map[OpCode]uint64{}        // op-code frequency stats
 		opCodeDuration     = map[OpCode]time.Duration{} // op-code duration stats (accumulated)
+		opCodeGas          = map[OpCode]uint64{}        // op-code gas stats (accumulated)
 		pcCounterFrequency = map[uint64]uint64{}        // pc-counter frequency stats
+		initialGas         = state.Contract.Gas         // gas available to the call frame
+		startTime          = time.Now()                 // start of the invocation
 
 	)
 
@@ -313,12 +325,26 @@ func (in *GethEVMInterpreter) runMicroProfiling(state *InterpreterState, input [
 			instructionFrequency[ctr]++
 		}
 
+		// a frame failing with an error other than a revert loses its
+		// remaining gas once it is back in evm.Call or evm.Create; the loss
+		// is charged to the operation at pc, which either failed or was not
+		// run because the step limit was hit
+		gas := initialGas - contract.Gas
+		if err != nil && err != ErrExecutionReverted {
+			gas = initialGas
+			opCodeGas[contract.GetOp(pc)] += contract.Gas
+		}
+
 		// construct statistical observation
 		mpd := MicroProfileData{
 			OpCodeFrequency:      opCodeFrequency,
 			OpCodeDuration:       opCodeDuration,
+			OpCodeGas:            opCodeGas,
 			InstructionFrequency: instructionFrequency,
-			StepLength:           steps}
+			StepLength:           steps,
+			CallDepth:            in.evm.Depth,
+			Gas:                  gas,
+			Elapsed:              time.Since(startTime)}
 
 		// process statistical observation
 		ProcessMicroProfileData(&mpd)
@@ -342,6 +368,12 @@ func (in *GethEVMInterpreter) runMicroProfiling(state *InterpreterState, input [
 		if steps%1000 == 0 && atomic.LoadInt32(&in.evm.abort) != 0 {
 			break
 		}
+		if in.cfg.MaxSteps > 0 {
+			in.evm.steps++
+			if in.evm.steps > in.cfg.MaxSteps {
+				return nil, ErrStepLimitExceeded
+			}
+		}
 		if in.cfg.Debug {
 			// Capture pre-execution values for tracing.
 			logged, pcCopy, gasCopy = false, pc, contract.Gas
@@ -378,6 +410,7 @@ func (in *GethEVMInterpreter) runMicroProfiling(state *InterpreterState, input [
 		if !contract.UseGas(operation.constantGas) {
 			return nil, ErrOutOfGas
 		}
+		opCodeGas[op] += operation.constantGas
 
 		var memorySize uint64
 		// calculate the new memory size and expand the memory to fit
@@ -405,6 +438,14 @@ func (in *GethEVMInterpreter) runMicroProfiling(state *InterpreterState, input [
 			if err != nil || !contract.UseGas(dynamicCost) {
 				return nil, ErrOutOfGas
 			}
+			// gas forwarded to a callee is charged to the callee's opcodes;
+			// the forwarded gas of CREATE and CREATE2 is not part of cost
+			switch op {
+			case CALL, CALLCODE, DELEGATECALL, STATICCALL:
+				opCodeGas[op] += dynamicCost - in.evm.callGasTemp
+			default:
+				opCodeGas[op] += dynamicCost
+			}
 		}
 		if memorySize > 0 {
 			mem.Resize(memorySize)
@@ -485,6 +526,10 @@ func (in *GethEVMInterpreter) runBasicBlockProfiling(state *InterpreterState, in
 			close(state.done)
 		}
 	}()
+	// A top-level call starts with a fresh step budget
+	if in.evm.Depth == 0 {
+		in.evm.steps = 0
+	}
 	// Increment the call depth which is restricted to 1024
 	in.evm.Depth++
 	defer func() { in.evm.Depth-- }()
@@ -576,6 +621,12 @@ func (in *GethEVMInterpreter) runBasicBlockProfiling(state *InterpreterState, in
 		if steps%1000 == 0 && atomic.LoadInt32(&in.evm.abort) != 0 {
 			break
 		}
+		if in.cfg.MaxSteps > 0 {
+			in.evm.steps++
+			if in.evm.steps > in.cfg.MaxSteps {
+				return nil, ErrStepLimitExceeded
+			}
+		}
 		if in.cfg.Debug {
 			// Capture pre-execution values for tracing.
 			logged, pcCopy, gasCopy = false, pc, contract.Gas
@@ -744,6 +795,10 @@ func (in *GethEVMInterpreter) runPlain(state *InterpreterState, input []byte, re
 			close(state.done)
 		}
 	}()
+	// A top-level call starts with a fresh step budget
+	if in.evm.Depth == 0 {
+		in.evm.steps = 0
+	}
 	// Increment the call depth which is restricted to 1024
 	in.evm.Depth++
 	defer func() { in.evm.Depth-- }()
@@ -826,6 +881,12 @@ func (in *GethEVMInterpreter) runPlain(state *InterpreterState, input []byte, re
 		if steps%1000 == 0 && atomic.LoadInt32(&in.evm.abort) != 0 {
 			break
 		}
+		if in.cfg.MaxSteps > 0 {
+			in.evm.steps++
+			if in.evm.steps > in.cfg.MaxSteps {
+				return nil, ErrStepLimitExceeded
+			}
+		}
 		if in.cfg.Debug {
 			// Capture pre-execution values for tracing.
 			logged, pcCopy, gasCopy = false, pc, contract.Gas
@@ -0,0 +1,128 @@
+// Copyright 2022 The go-fantom Authors
+// This file is part of the go-fantom library.
+//
+// The go-fantom library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// runTestCode deploys code to an account of a fresh in-memory state and
+// calls it with the given input and gas.
+func runTestCode(t *testing.T, code, input []byte, gas uint64, chainConfig *params.ChainConfig, cfg Config) ([]byte, uint64, error) {
+	t.Helper()
+
+	address := common.BytesToAddress([]byte("contract"))
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.CreateAccount(address)
+	statedb.SetCode(address, code)
+	statedb.Finalise(true)
+
+	vmctx := BlockContext{
+		BlockNumber: big.NewInt(0),
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+	}
+	vmenv := NewEVM(vmctx, TxContext{}, statedb, chainConfig, cfg)
+	return vmenv.Call(AccountRef(common.Address{}), address, input, gas, new(big.Int))
+}
+
+// selfCallCode calls itself with its input decremented by one until the
+// input is zero:
+//
+//	PUSH1 0, CALLDATALOAD, DUP1, ISZERO, PUSH1 0x1d, JUMPI,
+//	PUSH1 1, SWAP1, SUB, PUSH1 0, MSTORE,
+//	PUSH1 0, PUSH1 0, PUSH1 32, PUSH1 0, PUSH1 0, ADDRESS, GAS, CALL, POP,
+//	JUMPDEST, STOP
+const selfCallCode = "0x6000358015601d576001900360005260006000602060006000305af1505b00"
+
+// forEachRunVariant calls f once for every run variant of the interpreter,
+// with profiling channels of the given size that are drained after each call.
+// The profiling setup is restored afterwards.
+func forEachRunVariant(bufferSize int, f func(name string)) {
+	oldMicro, oldBasicBlock := MicroProfiling, BasicBlockProfiling
+	oldMpChannel, oldBbpChannel := mpChannel, bbpChannel
+	defer func() {
+		MicroProfiling, BasicBlockProfiling = oldMicro, oldBasicBlock
+		mpChannel, bbpChannel = oldMpChannel, oldBbpChannel
+	}()
+	mpChannel = make(chan *MicroProfileData, bufferSize)
+	bbpChannel = make(chan *BasicBlockProfileData, bufferSize)
+
+	variants := []struct {
+		name                string
+		microProfiling      bool
+		basicBlockProfiling bool
+	}{
+		{"plain", false, false},
+		{"micro-profiling", true, false},
+		{"basic-block-profiling", false, true},
+	}
+	for _, v := range variants {
+		MicroProfiling, BasicBlockProfiling = v.microProfiling, v.basicBlockProfiling
+		f(v.name)
+		for len(mpChannel) > 0 {
+			<-mpChannel
+		}
+		for len(bbpChannel) > 0 {
+			<-bbpChannel
+		}
+	}
+}
+
+// TestMaxSteps checks that an infinite loop is stopped by the step budget
+// in every run variant of the interpreter.
+func TestMaxSteps(t *testing.T) {
+	forEachRunVariant(1, func(name string) {
+		// JUMPDEST, PUSH1 0, JUMP
+		if _, _, err := runTestCode(t, hexutil.MustDecode("0x5b600056"), nil, 1000000, params.AllEthashProtocolChanges, Config{MaxSteps: 30}); err != ErrStepLimitExceeded {
+			t.Errorf("%s: error mismatch: have %v, want %v", name, err, ErrStepLimitExceeded)
+		}
+		if MicroProfiling {
+			if mpd := <-mpChannel; mpd.StepLength != 31 {
+				t.Errorf("%s: step length mismatch: have %d, want 31", name, mpd.StepLength)
+			}
+		}
+	})
+}
+
+// TestMaxStepsNested checks that the step budget covers the nested calls of
+// a top-level call rather than each call frame on its own.
+func TestMaxStepsNested(t *testing.T) {
+	// ten nested calls of 22 steps each and a final frame of 8 steps, no
+	// frame getting anywhere near the budget on its own
+	const steps = 10*22 + 8
+	input := common.LeftPadBytes([]byte{10}, 32)
+
+	forEachRunVariant(64, func(name string) {
+		if _, _, err := runTestCode(t, hexutil.MustDecode(selfCallCode), input, 1000000, params.AllEthashProtocolChanges, Config{MaxSteps: steps}); err != nil {
+			t.Errorf("%s: exact budget: have %v, want <nil>", name, err)
+		}
+		if _, _, err := runTestCode(t, hexutil.MustDecode(selfCallCode), input, 1000000, params.AllEthashProtocolChanges, Config{MaxSteps: steps - 1}); err != ErrStepLimitExceeded {
+			t.Errorf("%s: short budget: have %v, want %v", name, err, ErrStepLimitExceeded)
+		}
+		if _, _, err := runTestCode(t, hexutil.MustDecode(selfCallCode), input, 1000000, params.AllEthashProtocolChanges, Config{MaxSteps: -1}); err != nil {
+			t.Errorf("%s: negative budget: have %v, want <nil>", name, err)
+		}
+	})
+}
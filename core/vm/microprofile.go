@@ -17,10 +17,15 @@
 package vm
 
 import (
-	"context"
 	"database/sql"
+	"encoding/csv"
+	"encoding/json"
 	_ "github.com/mattn/go-sqlite3"
+	"io"
 	"log"
+	"sort"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,16 +33,32 @@ import (
 type MicroProfileData struct {
 	OpCodeFrequency      map[OpCode]uint64        // opcode frequency stats
 	OpCodeDuration       map[OpCode]time.Duration // opcode durations stats
+	OpCodeGas            map[OpCode]uint64        // opcode gas stats
 	InstructionFrequency map[uint64]uint64        // instruction frequency stats
 	StepLength           int                      // number of executed instructions
+	CallDepth            int                      // call depth of the invocation
+	Gas                  uint64                   // gas consumed including nested calls (without the code deposit of creations)
+	Elapsed              time.Duration            // wall time including nested calls
 }
 
 // Micro-profiling statistic
 type MicroProfileStatistic struct {
 	opCodeFrequency      map[OpCode]uint64 // opcode frequency statistics
 	opCodeDuration       map[OpCode]uint64 // accumulated duration of opcodes
+	opCodeGas            map[OpCode]uint64 // accumulated gas of opcodes
 	instructionFrequency map[uint64]uint64 // instruction frequency statistics
 	stepLengthFrequency  map[int]uint64    // smart contract length frequency
+	callDepthFrequency   map[int]uint64    // number of invocations per call depth
+	callDepthGas         map[int]uint64    // accumulated gas per call depth
+	elapsed              time.Duration     // accumulated wall time of top-level invocations
+}
+
+// Mean duration of an opcode derived from a micro-profiling statistic
+type OpCodeDurationSummary struct {
+	OpCode    OpCode        // opcode
+	Frequency uint64        // number of executions
+	Total     time.Duration // accumulated duration
+	Mean      time.Duration // mean duration per execution
 }
 
 // Micro profiling flag controlled by cli
@@ -46,63 +67,189 @@ var MicroProfiling bool
 // Buffer size for micro-profiling channel
 var MicroProfilingBufferSize int
 
-// Name of micro-profiling SQLITE3 database
+// Name of micro-profiling SQLITE3 database used if Dump is not given a path
 var MicroProfilingDB string
 
 // Micro-Profiling channel
 var mpChannel chan *MicroProfileData = make(chan *MicroProfileData, MicroProfilingBufferSize)
 
+// Number of producers blocked on a full micro-profiling channel
+var mpBlocked uint64
+
+// InitMicroProfiling (re)creates the micro-profiling channel with the given
+// buffer size and resets the count of blocked producers. It must be called
+// before workers and collectors are started.
+func InitMicroProfiling(bufferSize int) {
+	MicroProfilingBufferSize = bufferSize
+	mpChannel = make(chan *MicroProfileData, bufferSize)
+	atomic.StoreUint64(&mpBlocked, 0)
+}
+
 // Create new micro-profiling statistic
 func NewMicroProfileStatistic() *MicroProfileStatistic {
 	p := new(MicroProfileStatistic)
 	p.opCodeFrequency = make(map[OpCode]uint64)
 	p.opCodeDuration = make(map[OpCode]uint64)
+	p.opCodeGas = make(map[OpCode]uint64)
 	p.instructionFrequency = make(map[uint64]uint64)
 	p.stepLengthFrequency = make(map[int]uint64)
+	p.callDepthFrequency = make(map[int]uint64)
+	p.callDepthGas = make(map[int]uint64)
 	return p
 }
 
-// The data collector checks for a stopping signal and processes
-// the workers' records via a channel. A data collector is a background task.
-func MicroProfilingCollector(ctx context.Context, done chan struct{}, mps *MicroProfileStatistic) {
+// The data collector processes the workers' records via a channel until
+// the channel is closed by StopMicroProfiling. A data collector is a
+// background task. Every record sent before the channel is closed is
+// processed before done is closed.
+//
+// Several collectors may consume the channel concurrently, but each
+// collector must own its statistic. After all collectors are done, their
+// statistics are combined with Merge.
+func MicroProfilingCollector(done chan struct{}, mps *MicroProfileStatistic) {
 	defer close(done)
-	for {
-		select {
-
-		// receive a new data record from a worker?
-		case mpd := <- mpChannel:
-			// process the data record and update the statistic
-
-			// update op-code frequency
-			for opCode, freq := range mpd.OpCodeFrequency {
-				mps.opCodeFrequency[opCode] += freq
-			}
-
-			// update op-code duration
-			for opCode, duration := range mpd.OpCodeDuration {
-				mps.opCodeDuration[opCode] += uint64(duration)
-			}
-
-			// update instruction frequency
-			for instructions, freq := range mpd.InstructionFrequency {
-				mps.instructionFrequency[instructions] += freq
-			}
-
-			// step length frequency
-			mps.stepLengthFrequency[mpd.StepLength]++
-
-		// receive stop signal?
-		case <-ctx.Done():
-			if len(mpChannel) == 0 {
-				return
-			}
-		}
+	for mpd := range mpChannel {
+		mps.update(mpd)
 	}
 }
 
-// put micro profiling data into the processing queue
+// StopMicroProfiling closes the micro-profiling channel to signal the
+// collectors that all workers have finished. It must be called after the
+// last record has been produced; before profiling is restarted, the channel
+// has to be recreated with InitMicroProfiling.
+func StopMicroProfiling() {
+	close(mpChannel)
+}
+
+// update the statistic with a data record of a worker
+func (mps *MicroProfileStatistic) update(mpd *MicroProfileData) {
+	// update op-code frequency
+	for opCode, freq := range mpd.OpCodeFrequency {
+		mps.opCodeFrequency[opCode] += freq
+	}
+
+	// update op-code duration
+	for opCode, duration := range mpd.OpCodeDuration {
+		mps.opCodeDuration[opCode] += uint64(duration)
+	}
+
+	// update op-code gas
+	for opCode, gas := range mpd.OpCodeGas {
+		mps.opCodeGas[opCode] += gas
+	}
+
+	// update instruction frequency
+	for instructions, freq := range mpd.InstructionFrequency {
+		mps.instructionFrequency[instructions] += freq
+	}
+
+	// step length frequency
+	mps.stepLengthFrequency[mpd.StepLength]++
+
+	// call depth frequency and gas
+	mps.callDepthFrequency[mpd.CallDepth]++
+	mps.callDepthGas[mpd.CallDepth] += mpd.Gas
+
+	// wall time of top-level invocations; nested calls are part of it
+	if mpd.CallDepth == 1 {
+		mps.elapsed += mpd.Elapsed
+	}
+}
+
+// put micro profiling data into the processing queue; if the queue is
+// full, the producer blocks and the event is counted
 func ProcessMicroProfileData(mpd *MicroProfileData) {
-	mpChannel <- mpd
+	select {
+	case mpChannel <- mpd:
+	default:
+		atomic.AddUint64(&mpBlocked, 1)
+		mpChannel <- mpd
+	}
+}
+
+// MicroProfilingBlocked returns how often a producer found the
+// micro-profiling queue full and had to wait for a collector since the last
+// InitMicroProfiling
+func MicroProfilingBlocked() uint64 {
+	return atomic.LoadUint64(&mpBlocked)
+}
+
+// MicroProfilingQueueDepth returns the number of records waiting in the
+// micro-profiling queue
+func MicroProfilingQueueDepth() int {
+	return len(mpChannel)
+}
+
+// Reset clears all aggregates of the micro-profiling statistic in place
+func (mps *MicroProfileStatistic) Reset() {
+	for opCode := range mps.opCodeFrequency {
+		delete(mps.opCodeFrequency, opCode)
+	}
+	for opCode := range mps.opCodeDuration {
+		delete(mps.opCodeDuration, opCode)
+	}
+	for opCode := range mps.opCodeGas {
+		delete(mps.opCodeGas, opCode)
+	}
+	for instructions := range mps.instructionFrequency {
+		delete(mps.instructionFrequency, instructions)
+	}
+	for length := range mps.stepLengthFrequency {
+		delete(mps.stepLengthFrequency, length)
+	}
+	for depth := range mps.callDepthFrequency {
+		delete(mps.callDepthFrequency, depth)
+	}
+	for depth := range mps.callDepthGas {
+		delete(mps.callDepthGas, depth)
+	}
+	mps.elapsed = 0
+}
+
+// DurationSummary computes the mean duration per execution of each opcode
+// with a recorded duration. The summary is sorted by descending mean
+// duration. Opcodes without recorded executions have a zero mean. Only
+// accumulated durations are collected, hence percentiles are not available.
+func (mps *MicroProfileStatistic) DurationSummary() []OpCodeDurationSummary {
+	summary := make([]OpCodeDurationSummary, 0, len(mps.opCodeDuration))
+	for opCode, duration := range mps.opCodeDuration {
+		s := OpCodeDurationSummary{
+			OpCode:    opCode,
+			Frequency: mps.opCodeFrequency[opCode],
+			Total:     time.Duration(duration),
+		}
+		if s.Frequency > 0 {
+			s.Mean = time.Duration(duration / s.Frequency)
+		}
+		summary = append(summary, s)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Mean != summary[j].Mean {
+			return summary[i].Mean > summary[j].Mean
+		}
+		return summary[i].OpCode < summary[j].OpCode
+	})
+	return summary
+}
+
+// UnusedOpcodes returns the defined opcodes that have never been executed
+// in ascending order
+func (mps *MicroProfileStatistic) UnusedOpcodes() []OpCode {
+	unused := []OpCode{}
+	for opCode := range opCodeToString {
+		if mps.opCodeFrequency[opCode] == 0 {
+			unused = append(unused, opCode)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool { return unused[i] < unused[j] })
+	return unused
+}
+
+// OpCodeCoverage returns the percentage of defined opcodes that have been
+// executed at least once
+func (mps *MicroProfileStatistic) OpCodeCoverage() float64 {
+	used := len(opCodeToString) - len(mps.UnusedOpcodes())
+	return 100 * float64(used) / float64(len(opCodeToString))
 }
 
 // Merge two micro-profiling statistics
@@ -117,6 +264,11 @@ func (mps *MicroProfileStatistic) Merge(src *MicroProfileStatistic) {
 		mps.opCodeDuration[opCode] += uint64(duration)
 	}
 
+	// update opcode gas
+	for opCode, gas := range src.opCodeGas {
+		mps.opCodeGas[opCode] += gas
+	}
+
 	// update instruction frequency
 	for instructions, freq := range src.instructionFrequency {
 		mps.instructionFrequency[instructions] += freq
@@ -126,9 +278,46 @@ func (mps *MicroProfileStatistic) Merge(src *MicroProfileStatistic) {
 	for length, freq := range src.stepLengthFrequency {
 		mps.stepLengthFrequency[length] += freq
 	}
+
+	// call depth frequency and gas
+	for depth, freq := range src.callDepthFrequency {
+		mps.callDepthFrequency[depth] += freq
+	}
+	for depth, gas := range src.callDepthGas {
+		mps.callDepthGas[depth] += gas
+	}
+
+	// wall time
+	mps.elapsed += src.elapsed
+}
+
+// Elapsed returns the accumulated wall time of all top-level invocations
+func (mps *MicroProfileStatistic) Elapsed() time.Duration {
+	return mps.elapsed
+}
+
+// Instructions returns the number of executed instructions in all
+// invocations, including nested calls
+func (mps *MicroProfileStatistic) Instructions() uint64 {
+	var instructions uint64
+	for length, freq := range mps.stepLengthFrequency {
+		instructions += uint64(length) * freq
+	}
+	return instructions
 }
 
-// dump opcode frequency stats into a SQLITE3 database
+// InstructionsPerSecond returns the throughput of the interpreter, i.e.,
+// the executed instructions divided by the accumulated wall time of the
+// top-level invocations. It is zero if no time has been recorded.
+func (mps *MicroProfileStatistic) InstructionsPerSecond() float64 {
+	if mps.elapsed <= 0 {
+		return 0
+	}
+	return float64(mps.Instructions()) / mps.elapsed.Seconds()
+}
+
+// dump opcode frequency stats into a SQLITE3 database; opcodes are stored
+// by their mnemonic as returned by OpCode.String
 func (mps *MicroProfileStatistic) dumpOpCodeFrequency(db *sql.DB) {
 	// drop old frequency table and create new one
 	_, err := db.Exec("DROP TABLE IF EXISTS OpCodeFrequency;CREATE TABLE OpCodeFrequency ( opcode TEXT NOT NULL, frequency INTEGER NOT NULL, PRIMARY KEY (opcode));")
@@ -141,8 +330,8 @@ func (mps *MicroProfileStatistic) dumpOpCodeFrequency(db *sql.DB) {
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
-	for opCode, freq := range mps.opCodeFrequency {
-		_, err = statement.Exec(opCodeToString[opCode], freq)
+	for _, opCode := range sortedOpCodes(mps.opCodeFrequency) {
+		_, err = statement.Exec(opCode.String(), mps.opCodeFrequency[opCode])
 		if err != nil {
 			log.Fatalln(err.Error())
 		}
@@ -163,8 +352,30 @@ func (mps *MicroProfileStatistic) dumpOpCodeDuration(db *sql.DB) {
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
-	for opCode, duration := range mps.opCodeDuration {
-		_, err = statement.Exec(opCodeToString[opCode], duration)
+	for _, opCode := range sortedOpCodes(mps.opCodeDuration) {
+		_, err = statement.Exec(opCode.String(), mps.opCodeDuration[opCode])
+		if err != nil {
+			log.Fatalln(err.Error())
+		}
+
+	}
+}
+
+// dump opcode gas statistic
+func (mps *MicroProfileStatistic) dumpOpCodeGas(db *sql.DB) {
+	// drop old gas table and create new one
+	_, err := db.Exec("DROP TABLE IF EXISTS OpCodeGas;CREATE TABLE OpCodeGas ( opcode TEXT NOT NULL, gas INTEGER NOT NULL, PRIMARY KEY (opcode));")
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	// prepare an insert statement for faster inserts and insert gas
+	statement, err := db.Prepare("INSERT INTO OpCodeGas(opcode, gas) VALUES (?, ?)")
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	for _, opCode := range sortedOpCodes(mps.opCodeGas) {
+		_, err = statement.Exec(opCode.String(), mps.opCodeGas[opCode])
 		if err != nil {
 			log.Fatalln(err.Error())
 		}
@@ -185,8 +396,8 @@ func (mps *MicroProfileStatistic) dumpInstructionFrequency(db *sql.DB) {
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
-	for instructions, freq := range mps.instructionFrequency {
-		_, err = statement.Exec(instructions, freq)
+	for _, instructions := range sortedInstructions(mps.instructionFrequency) {
+		_, err = statement.Exec(instructions, mps.instructionFrequency[instructions])
 		if err != nil {
 			log.Fatalln(err.Error())
 		}
@@ -207,8 +418,8 @@ func (mps *MicroProfileStatistic) dumpStepLengthFrequency(db *sql.DB) {
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
-	for length, freq := range mps.stepLengthFrequency {
-		_, err = statement.Exec(length, freq)
+	for _, length := range sortedIntKeys(mps.stepLengthFrequency) {
+		_, err = statement.Exec(length, mps.stepLengthFrequency[length])
 		if err != nil {
 			log.Fatalln(err.Error())
 		}
@@ -216,13 +427,53 @@ func (mps *MicroProfileStatistic) dumpStepLengthFrequency(db *sql.DB) {
 	}
 }
 
+// dump call-depth statistic
+func (mps *MicroProfileStatistic) dumpCallDepth(db *sql.DB) {
+	// drop old call-depth table and create new one
+	_, err := db.Exec("DROP TABLE IF EXISTS CallDepth;CREATE TABLE CallDepth ( depth INTEGER NOT NULL, frequency INTEGER NOT NULL, gas INTEGER NOT NULL, PRIMARY KEY (depth));")
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
 
-// dump micro-profiling statistic into a sqlite3 database
-func (mps *MicroProfileStatistic) Dump(version string) {
+	// prepare an insert statement for faster inserts and insert depths
+	statement, err := db.Prepare("INSERT INTO CallDepth(depth, frequency, gas) VALUES (?, ?, ?)")
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	for _, depth := range sortedIntKeys(mps.callDepthFrequency) {
+		_, err = statement.Exec(depth, mps.callDepthFrequency[depth], mps.callDepthGas[depth])
+		if err != nil {
+			log.Fatalln(err.Error())
+		}
+
+	}
+}
+
+// dump throughput statistic
+func (mps *MicroProfileStatistic) dumpThroughput(db *sql.DB) {
+	// drop old throughput table and create new one
+	_, err := db.Exec("DROP TABLE IF EXISTS Throughput;CREATE TABLE Throughput ( elapsed INTEGER NOT NULL, instructions INTEGER NOT NULL, ips NUMERIC NOT NULL);")
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	// insert the single throughput record
+	_, err = db.Exec("INSERT INTO Throughput(elapsed, instructions, ips) VALUES (?, ?, ?)", int64(mps.elapsed), mps.Instructions(), mps.InstructionsPerSecond())
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+}
+
+// dump micro-profiling statistic into a sqlite3 database; if dbPath is
+// empty, the database named by MicroProfilingDB is used. Rows are inserted
+// in ascending key order so that equal statistics yield equal tables.
+func (mps *MicroProfileStatistic) Dump(dbPath string, version string) {
+	if dbPath == "" {
+		dbPath = MicroProfilingDB
+	}
 
 	// open sqlite3 database
-	// TODO: have parameters for sqlite3 database name
-	db, err := sql.Open("sqlite3", MicroProfilingDB) // Open the created SQLite File
+	db, err := sql.Open("sqlite3", dbPath) // Open the created SQLite File
 	if err != nil {
 		log.Fatal(err.Error())
 	}
@@ -244,7 +495,13 @@ func (mps *MicroProfileStatistic) Dump(version string) {
 		log.Fatalln(err.Error())
 	}
 
-	_, err = db.Exec("INSERT INTO Information (version) VALUES (\"" + version + "\")")
+	// insert version with a prepared statement so that arbitrary
+	// version strings are stored verbatim
+	statement, err := db.Prepare("INSERT INTO Information (version) VALUES (?)")
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	_, err = statement.Exec(version)
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
@@ -255,9 +512,175 @@ func (mps *MicroProfileStatistic) Dump(version string) {
 	// dump op-code durations
 	mps.dumpOpCodeDuration(db)
 
+	// dump op-code gas
+	mps.dumpOpCodeGas(db)
+
 	// dump instruction frequency
 	mps.dumpInstructionFrequency(db)
 
 	// dump step-length frequency
 	mps.dumpStepLengthFrequency(db)
+
+	// dump call-depth statistic
+	mps.dumpCallDepth(db)
+
+	// dump throughput
+	mps.dumpThroughput(db)
+}
+
+// return opcodes of a statistic in ascending order
+func sortedOpCodes(m map[OpCode]uint64) []OpCode {
+	opCodes := make([]OpCode, 0, len(m))
+	for opCode := range m {
+		opCodes = append(opCodes, opCode)
+	}
+	sort.Slice(opCodes, func(i, j int) bool { return opCodes[i] < opCodes[j] })
+	return opCodes
+}
+
+// return instruction counts of a statistic in ascending order
+func sortedInstructions(m map[uint64]uint64) []uint64 {
+	instructions := make([]uint64, 0, len(m))
+	for i := range m {
+		instructions = append(instructions, i)
+	}
+	sort.Slice(instructions, func(i, j int) bool { return instructions[i] < instructions[j] })
+	return instructions
+}
+
+// return the integer keys of a statistic (e.g. step lengths or call depths)
+// in ascending order
+func sortedIntKeys(m map[int]uint64) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// JSON record of an opcode statistic
+type opCodeFrequencyJSON struct {
+	OpCode    string `json:"opcode"`
+	Frequency uint64 `json:"frequency"`
+}
+
+// JSON record of an opcode duration statistic
+type opCodeDurationJSON struct {
+	OpCode   string `json:"opcode"`
+	Duration uint64 `json:"duration"`
+}
+
+// JSON record of an opcode gas statistic
+type opCodeGasJSON struct {
+	OpCode string `json:"opcode"`
+	Gas    uint64 `json:"gas"`
+}
+
+// JSON record of an instruction frequency statistic
+type instructionFrequencyJSON struct {
+	Instructions uint64 `json:"instructions"`
+	Frequency    uint64 `json:"frequency"`
+}
+
+// JSON record of a step-length frequency statistic
+type stepLengthFrequencyJSON struct {
+	StepLength int    `json:"steplength"`
+	Frequency  uint64 `json:"frequency"`
+}
+
+// JSON record of a call-depth statistic
+type callDepthJSON struct {
+	Depth     int    `json:"depth"`
+	Frequency uint64 `json:"frequency"`
+	Gas       uint64 `json:"gas"`
+}
+
+// JSON representation of a micro-profiling statistic
+type microProfileStatisticJSON struct {
+	OpCodeFrequency      []opCodeFrequencyJSON      `json:"opCodeFrequency"`
+	OpCodeDuration       []opCodeDurationJSON       `json:"opCodeDuration"`
+	OpCodeGas            []opCodeGasJSON            `json:"opCodeGas"`
+	InstructionFrequency []instructionFrequencyJSON `json:"instructionFrequency"`
+	StepLengthFrequency  []stepLengthFrequencyJSON  `json:"stepLengthFrequency"`
+	CallDepth            []callDepthJSON            `json:"callDepth"`
+}
+
+// dump micro-profiling statistic as JSON; records are sorted by key
+func (mps *MicroProfileStatistic) DumpJSON(w io.Writer) error {
+	data := microProfileStatisticJSON{
+		OpCodeFrequency:      []opCodeFrequencyJSON{},
+		OpCodeDuration:       []opCodeDurationJSON{},
+		OpCodeGas:            []opCodeGasJSON{},
+		InstructionFrequency: []instructionFrequencyJSON{},
+		StepLengthFrequency:  []stepLengthFrequencyJSON{},
+		CallDepth:            []callDepthJSON{},
+	}
+	for _, opCode := range sortedOpCodes(mps.opCodeFrequency) {
+		data.OpCodeFrequency = append(data.OpCodeFrequency, opCodeFrequencyJSON{opCode.String(), mps.opCodeFrequency[opCode]})
+	}
+	for _, opCode := range sortedOpCodes(mps.opCodeDuration) {
+		data.OpCodeDuration = append(data.OpCodeDuration, opCodeDurationJSON{opCode.String(), mps.opCodeDuration[opCode]})
+	}
+	for _, opCode := range sortedOpCodes(mps.opCodeGas) {
+		data.OpCodeGas = append(data.OpCodeGas, opCodeGasJSON{opCode.String(), mps.opCodeGas[opCode]})
+	}
+	for _, instructions := range sortedInstructions(mps.instructionFrequency) {
+		data.InstructionFrequency = append(data.InstructionFrequency, instructionFrequencyJSON{instructions, mps.instructionFrequency[instructions]})
+	}
+	for _, length := range sortedIntKeys(mps.stepLengthFrequency) {
+		data.StepLengthFrequency = append(data.StepLengthFrequency, stepLengthFrequencyJSON{length, mps.stepLengthFrequency[length]})
+	}
+	for _, depth := range sortedIntKeys(mps.callDepthFrequency) {
+		data.CallDepth = append(data.CallDepth, callDepthJSON{depth, mps.callDepthFrequency[depth], mps.callDepthGas[depth]})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+// dump micro-profiling statistic as CSV with one (table, key, value) row
+// per record; tables are named as in the SQLITE3 database, except for the
+// CallDepth table whose frequency and gas columns are written as
+// CallDepthFrequency and CallDepthGas rows, and records are sorted by key
+func (mps *MicroProfileStatistic) DumpCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"table", "key", "value"}); err != nil {
+		return err
+	}
+	for _, opCode := range sortedOpCodes(mps.opCodeFrequency) {
+		if err := cw.Write([]string{"OpCodeFrequency", opCode.String(), strconv.FormatUint(mps.opCodeFrequency[opCode], 10)}); err != nil {
+			return err
+		}
+	}
+	for _, opCode := range sortedOpCodes(mps.opCodeDuration) {
+		if err := cw.Write([]string{"OpCodeDuration", opCode.String(), strconv.FormatUint(mps.opCodeDuration[opCode], 10)}); err != nil {
+			return err
+		}
+	}
+	for _, opCode := range sortedOpCodes(mps.opCodeGas) {
+		if err := cw.Write([]string{"OpCodeGas", opCode.String(), strconv.FormatUint(mps.opCodeGas[opCode], 10)}); err != nil {
+			return err
+		}
+	}
+	for _, instructions := range sortedInstructions(mps.instructionFrequency) {
+		if err := cw.Write([]string{"InstructionFrequency", strconv.FormatUint(instructions, 10), strconv.FormatUint(mps.instructionFrequency[instructions], 10)}); err != nil {
+			return err
+		}
+	}
+	for _, length := range sortedIntKeys(mps.stepLengthFrequency) {
+		if err := cw.Write([]string{"StepLengthFrequency", strconv.Itoa(length), strconv.FormatUint(mps.stepLengthFrequency[length], 10)}); err != nil {
+			return err
+		}
+	}
+	for _, depth := range sortedIntKeys(mps.callDepthFrequency) {
+		if err := cw.Write([]string{"CallDepthFrequency", strconv.Itoa(depth), strconv.FormatUint(mps.callDepthFrequency[depth], 10)}); err != nil {
+			return err
+		}
+		if err := cw.Write([]string{"CallDepthGas", strconv.Itoa(depth), strconv.FormatUint(mps.callDepthGas[depth], 10)}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
 }
@@ -0,0 +1,321 @@
+// Copyright 2022 The go-fantom Authors
+// This file is part of the go-fantom library.
+//
+// The go-fantom library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build parquet
+// +build parquet
+
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Parquet physical types, repetition types, converted types, encodings and
+// page types as defined by parquet.thrift
+const (
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetUTF8     = 0
+
+	parquetPlain        = 0
+	parquetRLE          = 3
+	parquetUncompressed = 0
+	parquetDataPage     = 0
+)
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// parquetColumn is a flat column of required values of a Parquet file
+type parquetColumn struct {
+	name      string
+	typ       int32  // physical type
+	utf8      bool   // byte arrays hold UTF-8 strings
+	numValues int    // number of values
+	data      []byte // PLAIN encoded values
+}
+
+// create an INT64 column
+func int64Column(name string, values []int64) parquetColumn {
+	data := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(data[8*i:], uint64(v))
+	}
+	return parquetColumn{name: name, typ: parquetInt64, numValues: len(values), data: data}
+}
+
+// create a DOUBLE column
+func doubleColumn(name string, values []float64) parquetColumn {
+	data := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(v))
+	}
+	return parquetColumn{name: name, typ: parquetDouble, numValues: len(values), data: data}
+}
+
+// create a BYTE_ARRAY column of UTF-8 strings
+func stringColumn(name string, values []string) parquetColumn {
+	var data []byte
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(v)))
+		data = append(data, v...)
+	}
+	return parquetColumn{name: name, typ: parquetByteArray, utf8: true, numValues: len(values), data: data}
+}
+
+// thriftWriter encodes structs in the Thrift compact protocol
+type thriftWriter struct {
+	buf     bytes.Buffer
+	lastIDs []int16 // last field id of each open struct
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *thriftWriter) fieldHeader(id int16, typ byte) {
+	last := &w.lastIDs[len(w.lastIDs)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.zigzag(int64(id))
+	}
+	*last = id
+}
+
+// beginStruct opens a top-level struct or a struct element of a list
+func (w *thriftWriter) beginStruct() {
+	w.lastIDs = append(w.lastIDs, 0)
+}
+
+func (w *thriftWriter) endStruct() {
+	w.buf.WriteByte(0)
+	w.lastIDs = w.lastIDs[:len(w.lastIDs)-1]
+}
+
+func (w *thriftWriter) structField(id int16) {
+	w.fieldHeader(id, thriftStruct)
+	w.beginStruct()
+}
+
+func (w *thriftWriter) i32Field(id int16, v int32) {
+	w.fieldHeader(id, thriftI32)
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) i64Field(id int16, v int64) {
+	w.fieldHeader(id, thriftI64)
+	w.zigzag(v)
+}
+
+func (w *thriftWriter) binary(b []byte) {
+	w.varint(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *thriftWriter) stringField(id int16, s string) {
+	w.fieldHeader(id, thriftBinary)
+	w.binary([]byte(s))
+}
+
+// listField starts a list field; the caller writes the size elements
+func (w *thriftWriter) listField(id int16, elemType byte, size int) {
+	w.fieldHeader(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		w.buf.WriteByte(0xf0 | elemType)
+		w.varint(uint64(size))
+	}
+}
+
+// writeParquetFile writes the columns as a Parquet file with a single row
+// group holding a single uncompressed data page per column
+func writeParquetFile(path string, columns []parquetColumn) error {
+	var (
+		file    bytes.Buffer
+		offsets = make([]int64, len(columns))
+		sizes   = make([]int64, len(columns))
+		numRows int
+	)
+	file.WriteString("PAR1")
+	for i, c := range columns {
+		// values are required, so the page holds no repetition or
+		// definition levels
+		var header thriftWriter
+		header.beginStruct()
+		header.i32Field(1, parquetDataPage)
+		header.i32Field(2, int32(len(c.data)))
+		header.i32Field(3, int32(len(c.data)))
+		header.structField(5)
+		header.i32Field(1, int32(c.numValues))
+		header.i32Field(2, parquetPlain)
+		header.i32Field(3, parquetRLE)
+		header.i32Field(4, parquetRLE)
+		header.endStruct()
+		header.endStruct()
+
+		offsets[i] = int64(file.Len())
+		sizes[i] = int64(header.buf.Len() + len(c.data))
+		file.Write(header.buf.Bytes())
+		file.Write(c.data)
+		numRows = c.numValues
+	}
+
+	var meta thriftWriter
+	meta.beginStruct()
+	meta.i32Field(1, 1)
+	meta.listField(2, thriftStruct, len(columns)+1)
+	meta.beginStruct()
+	meta.stringField(4, "schema")
+	meta.i32Field(5, int32(len(columns)))
+	meta.endStruct()
+	for _, c := range columns {
+		meta.beginStruct()
+		meta.i32Field(1, c.typ)
+		meta.i32Field(3, parquetRequired)
+		meta.stringField(4, c.name)
+		if c.utf8 {
+			meta.i32Field(6, parquetUTF8)
+		}
+		meta.endStruct()
+	}
+	meta.i64Field(3, int64(numRows))
+	meta.listField(4, thriftStruct, 1)
+	meta.beginStruct()
+	meta.listField(1, thriftStruct, len(columns))
+	var total int64
+	for i, c := range columns {
+		meta.beginStruct()
+		meta.i64Field(2, offsets[i])
+		meta.structField(3)
+		meta.i32Field(1, c.typ)
+		meta.listField(2, thriftI32, 2)
+		meta.zigzag(parquetPlain)
+		meta.zigzag(parquetRLE)
+		meta.listField(3, thriftBinary, 1)
+		meta.binary([]byte(c.name))
+		meta.i32Field(4, parquetUncompressed)
+		meta.i64Field(5, int64(c.numValues))
+		meta.i64Field(6, sizes[i])
+		meta.i64Field(7, sizes[i])
+		meta.i64Field(9, offsets[i])
+		meta.endStruct()
+		meta.endStruct()
+		total += sizes[i]
+	}
+	meta.i64Field(2, total)
+	meta.i64Field(3, int64(numRows))
+	meta.endStruct()
+	meta.endStruct()
+
+	file.Write(meta.buf.Bytes())
+	file.Write(binary.LittleEndian.AppendUint32(nil, uint32(meta.buf.Len())))
+	file.WriteString("PAR1")
+	return ioutil.WriteFile(path, file.Bytes(), 0644)
+}
+
+// create the opcode and value columns of an opcode statistic
+func opCodeColumns(m map[OpCode]uint64, valueName string) []parquetColumn {
+	var (
+		opCodes []string
+		values  []int64
+	)
+	for _, opCode := range sortedOpCodes(m) {
+		opCodes = append(opCodes, opCode.String())
+		values = append(values, int64(m[opCode]))
+	}
+	return []parquetColumn{stringColumn("opcode", opCodes), int64Column(valueName, values)}
+}
+
+// DumpParquet writes the micro-profiling statistic as Parquet files into the
+// directory dir, one file per table of the SQLITE3 database (e.g.
+// OpCodeFrequency.parquet) with the same columns. Records are sorted by key.
+// DumpParquet is only available in builds with the parquet tag.
+func (mps *MicroProfileStatistic) DumpParquet(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var instructions, instructionFrequency []int64
+	for _, i := range sortedInstructions(mps.instructionFrequency) {
+		instructions = append(instructions, int64(i))
+		instructionFrequency = append(instructionFrequency, int64(mps.instructionFrequency[i]))
+	}
+	var stepLengths, stepLengthFrequency []int64
+	for _, length := range sortedIntKeys(mps.stepLengthFrequency) {
+		stepLengths = append(stepLengths, int64(length))
+		stepLengthFrequency = append(stepLengthFrequency, int64(mps.stepLengthFrequency[length]))
+	}
+	var depths, depthFrequency, depthGas []int64
+	for _, depth := range sortedIntKeys(mps.callDepthFrequency) {
+		depths = append(depths, int64(depth))
+		depthFrequency = append(depthFrequency, int64(mps.callDepthFrequency[depth]))
+		depthGas = append(depthGas, int64(mps.callDepthGas[depth]))
+	}
+
+	tables := []struct {
+		name    string
+		columns []parquetColumn
+	}{
+		{"OpCodeFrequency", opCodeColumns(mps.opCodeFrequency, "frequency")},
+		{"OpCodeDuration", opCodeColumns(mps.opCodeDuration, "duration")},
+		{"OpCodeGas", opCodeColumns(mps.opCodeGas, "gas")},
+		{"InstructionFrequency", []parquetColumn{
+			int64Column("instructions", instructions),
+			int64Column("frequency", instructionFrequency),
+		}},
+		{"StepLengthFrequency", []parquetColumn{
+			int64Column("steplength", stepLengths),
+			int64Column("frequency", stepLengthFrequency),
+		}},
+		{"CallDepth", []parquetColumn{
+			int64Column("depth", depths),
+			int64Column("frequency", depthFrequency),
+			int64Column("gas", depthGas),
+		}},
+		{"Throughput", []parquetColumn{
+			int64Column("elapsed", []int64{int64(mps.elapsed)}),
+			int64Column("instructions", []int64{int64(mps.Instructions())}),
+			doubleColumn("ips", []float64{mps.InstructionsPerSecond()}),
+		}},
+	}
+	for _, table := range tables {
+		if err := writeParquetFile(filepath.Join(dir, table.name+".parquet"), table.columns); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2022 The go-fantom Authors
+// This file is part of the go-fantom library.
+//
+// The go-fantom library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+//go:build parquet
+// +build parquet
+
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// thriftReader decodes the Thrift compact protocol into generic values:
+// integers as int64, binaries as []byte, lists as []interface{} and structs
+// as maps from field id to value
+type thriftReader struct {
+	r *bytes.Reader
+}
+
+func (r *thriftReader) zigzag() int64 {
+	v, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		panic(err)
+	}
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case 3:
+		b, _ := r.r.ReadByte()
+		return int64(int8(b))
+	case 4, 5, 6:
+		return r.zigzag()
+	case 7:
+		var b [8]byte
+		r.r.Read(b[:])
+		return math.Float64frombits(binary.LittleEndian.Uint64(b[:]))
+	case 8:
+		n, _ := binary.ReadUvarint(r.r)
+		b := make([]byte, n)
+		r.r.Read(b)
+		return b
+	case 9, 10:
+		header, _ := r.r.ReadByte()
+		size := uint64(header >> 4)
+		if size == 15 {
+			size, _ = binary.ReadUvarint(r.r)
+		}
+		list := make([]interface{}, size)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case 12:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("unsupported thrift type %d", typ))
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var id int16
+	for {
+		header, _ := r.r.ReadByte()
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(header & 0x0f)
+	}
+}
+
+// readParquetFile reads the columns of a flat Parquet file written with
+// PLAIN encoded, uncompressed data pages
+func readParquetFile(t *testing.T, path string) map[string][]interface{} {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	if string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatalf("%s: magic mismatch", path)
+	}
+	length := binary.LittleEndian.Uint32(data[len(data)-8:])
+	footer := data[len(data)-8-int(length) : len(data)-8]
+	meta := (&thriftReader{bytes.NewReader(footer)}).structure()
+
+	columns := map[string][]interface{}{}
+	rowGroup := meta[4].([]interface{})[0].(map[int16]interface{})
+	for _, chunk := range rowGroup[1].([]interface{}) {
+		md := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+		name := string(md[3].([]interface{})[0].([]byte))
+		if codec := md[4].(int64); codec != parquetUncompressed {
+			t.Fatalf("%s: column %s: unsupported codec %d", path, name, codec)
+		}
+
+		page := bytes.NewReader(data[md[9].(int64):])
+		header := (&thriftReader{page}).structure()
+		values := make([]byte, header[3].(int64))
+		page.Read(values)
+		dataHeader := header[5].(map[int16]interface{})
+		if encoding := dataHeader[2].(int64); encoding != parquetPlain {
+			t.Fatalf("%s: column %s: unsupported encoding %d", path, name, encoding)
+		}
+
+		column := []interface{}{}
+		for i := int64(0); i < dataHeader[1].(int64); i++ {
+			switch md[1].(int64) {
+			case parquetInt64:
+				column = append(column, int64(binary.LittleEndian.Uint64(values)))
+				values = values[8:]
+			case parquetDouble:
+				column = append(column, math.Float64frombits(binary.LittleEndian.Uint64(values)))
+				values = values[8:]
+			case parquetByteArray:
+				n := binary.LittleEndian.Uint32(values)
+				column = append(column, string(values[4:4+n]))
+				values = values[4+n:]
+			default:
+				t.Fatalf("%s: column %s: unsupported type %d", path, name, md[1])
+			}
+		}
+		columns[name] = column
+	}
+	for name, column := range columns {
+		if have, want := int64(len(column)), meta[3].(int64); have != want {
+			t.Errorf("%s: column %s: row count mismatch: have %d, want %d", path, name, have, want)
+		}
+	}
+	return columns
+}
+
+func TestMicroProfileDumpParquet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "microprofiling")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	mps := NewMicroProfileStatistic()
+	mps.update(&MicroProfileData{
+		OpCodeFrequency:      map[OpCode]uint64{PUSH1: 2, ADD: 1, STOP: 1},
+		OpCodeDuration:       map[OpCode]time.Duration{PUSH1: 20, ADD: 10, STOP: 5},
+		OpCodeGas:            map[OpCode]uint64{PUSH1: 6, ADD: 3},
+		InstructionFrequency: map[uint64]uint64{0: 1, 1: 2},
+		StepLength:           4,
+		CallDepth:            1,
+		Gas:                  9,
+		Elapsed:              time.Second,
+	})
+	if err := mps.DumpParquet(dir); err != nil {
+		t.Fatalf("failed to dump statistic: %v", err)
+	}
+
+	tests := []struct {
+		table string
+		want  map[string][]interface{}
+	}{
+		{"OpCodeFrequency", map[string][]interface{}{
+			"opcode":    {"STOP", "ADD", "PUSH1"},
+			"frequency": {int64(1), int64(1), int64(2)},
+		}},
+		{"OpCodeDuration", map[string][]interface{}{
+			"opcode":   {"STOP", "ADD", "PUSH1"},
+			"duration": {int64(5), int64(10), int64(20)},
+		}},
+		{"OpCodeGas", map[string][]interface{}{
+			"opcode": {"ADD", "PUSH1"},
+			"gas":    {int64(3), int64(6)},
+		}},
+		{"InstructionFrequency", map[string][]interface{}{
+			"instructions": {int64(0), int64(1)},
+			"frequency":    {int64(1), int64(2)},
+		}},
+		{"StepLengthFrequency", map[string][]interface{}{
+			"steplength": {int64(4)},
+			"frequency":  {int64(1)},
+		}},
+		{"CallDepth", map[string][]interface{}{
+			"depth":     {int64(1)},
+			"frequency": {int64(1)},
+			"gas":       {int64(9)},
+		}},
+		{"Throughput", map[string][]interface{}{
+			"elapsed":      {int64(time.Second)},
+			"instructions": {int64(4)},
+			"ips":          {float64(4)},
+		}},
+	}
+	for _, tt := range tests {
+		have := readParquetFile(t, filepath.Join(dir, tt.table+".parquet"))
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("%s: columns mismatch: have %v, want %v", tt.table, have, tt.want)
+		}
+	}
+}
@@ -0,0 +1,737 @@
+// Copyright 2022 The go-fantom Authors
+// This file is part of the go-fantom library.
+//
+// The go-fantom library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// microProfilingTestDB returns the path of a fresh database in a temporary
+// directory and a cleanup function removing it.
+func microProfilingTestDB(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "microprofiling")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	return filepath.Join(dir, "microprofiling.db"), func() { os.RemoveAll(dir) }
+}
+
+func TestMicroProfileDumpVersion(t *testing.T) {
+	path, cleanup := microProfilingTestDB(t)
+	defer cleanup()
+
+	versions := []string{"v1.2.3", `1.0 "quoted"`, "it's", "x\"); DROP TABLE Information; --"}
+	for _, version := range versions {
+		NewMicroProfileStatistic().Dump(path, version)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT version FROM Information ORDER BY rowid")
+	if err != nil {
+		t.Fatalf("failed to query versions: %v", err)
+	}
+	defer rows.Close()
+
+	var have []string
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			t.Fatalf("failed to scan version: %v", err)
+		}
+		have = append(have, version)
+	}
+	if len(have) != len(versions) {
+		t.Fatalf("version count mismatch: have %d, want %d", len(have), len(versions))
+	}
+	for i, version := range versions {
+		if have[i] != version {
+			t.Errorf("version %d mismatch: have %q, want %q", i, have[i], version)
+		}
+	}
+}
+
+func TestMicroProfileDumpStepLengthFrequency(t *testing.T) {
+	path, cleanup := microProfilingTestDB(t)
+	defer cleanup()
+
+	mps := NewMicroProfileStatistic()
+	mps.instructionFrequency[7] = 3
+	mps.stepLengthFrequency[10] = 2
+	mps.stepLengthFrequency[25] = 1
+	mps.Dump(path, "test")
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT steplength, frequency FROM StepLengthFrequency")
+	if err != nil {
+		t.Fatalf("failed to query step-length frequency: %v", err)
+	}
+	defer rows.Close()
+
+	have := make(map[int]uint64)
+	for rows.Next() {
+		var (
+			length int
+			freq   uint64
+		)
+		if err := rows.Scan(&length, &freq); err != nil {
+			t.Fatalf("failed to scan step-length frequency: %v", err)
+		}
+		have[length] = freq
+	}
+	if len(have) != len(mps.stepLengthFrequency) {
+		t.Fatalf("row count mismatch: have %d, want %d", len(have), len(mps.stepLengthFrequency))
+	}
+	for length, freq := range mps.stepLengthFrequency {
+		if have[length] != freq {
+			t.Errorf("step length %d: frequency mismatch: have %d, want %d", length, have[length], freq)
+		}
+	}
+
+	// the instruction-frequency table must only contain its own rows
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM InstructionFrequency").Scan(&count); err != nil {
+		t.Fatalf("failed to count instruction frequency rows: %v", err)
+	}
+	if count != len(mps.instructionFrequency) {
+		t.Errorf("instruction frequency row count mismatch: have %d, want %d", count, len(mps.instructionFrequency))
+	}
+}
+
+func TestMicroProfileDumpPath(t *testing.T) {
+	path, cleanup := microProfilingTestDB(t)
+	defer cleanup()
+
+	NewMicroProfileStatistic().Dump(path, "test")
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	tables := []string{"Information", "OpCodeFrequency", "OpCodeDuration", "InstructionFrequency", "StepLengthFrequency"}
+	for _, table := range tables {
+		var name string
+		err := db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name=?", table).Scan(&name)
+		if err != nil {
+			t.Errorf("table %s not found in %s: %v", table, path, err)
+		}
+	}
+}
+
+func TestMicroProfilingCollectorDrain(t *testing.T) {
+	const numRecords = 100
+
+	// queue all records before the collector runs
+	oldChannel := mpChannel
+	mpChannel = make(chan *MicroProfileData, numRecords)
+	defer func() { mpChannel = oldChannel }()
+	for i := 0; i < numRecords; i++ {
+		ProcessMicroProfileData(&MicroProfileData{
+			OpCodeFrequency: map[OpCode]uint64{ADD: 1},
+			StepLength:      i % 10,
+		})
+	}
+
+	// stop straight away; the collector must still process every record
+	StopMicroProfiling()
+	done := make(chan struct{})
+	mps := NewMicroProfileStatistic()
+	MicroProfilingCollector(done, mps)
+	<-done
+
+	if freq := mps.opCodeFrequency[ADD]; freq != numRecords {
+		t.Errorf("ADD frequency mismatch: have %d, want %d", freq, numRecords)
+	}
+	var total uint64
+	for _, freq := range mps.stepLengthFrequency {
+		total += freq
+	}
+	if total != numRecords {
+		t.Errorf("step-length records mismatch: have %d, want %d", total, numRecords)
+	}
+}
+
+func TestMicroProfilingCollectorWaitsForStop(t *testing.T) {
+	const numRecords = 10
+
+	oldChannel := mpChannel
+	mpChannel = make(chan *MicroProfileData, numRecords)
+	defer func() { mpChannel = oldChannel }()
+
+	done := make(chan struct{})
+	mps := NewMicroProfileStatistic()
+	go MicroProfilingCollector(done, mps)
+
+	// let the collector go idle on an empty channel before the worker
+	// produces its records; it must keep running until it is stopped
+	for i := 0; i < numRecords; i++ {
+		select {
+		case <-done:
+			t.Fatalf("collector finished before being stopped")
+		case <-time.After(time.Millisecond):
+		}
+		ProcessMicroProfileData(&MicroProfileData{OpCodeFrequency: map[OpCode]uint64{ADD: 1}})
+	}
+	StopMicroProfiling()
+	<-done
+
+	if freq := mps.opCodeFrequency[ADD]; freq != numRecords {
+		t.Errorf("ADD frequency mismatch: have %d, want %d", freq, numRecords)
+	}
+}
+
+// fixed statistic used by the golden-file tests
+func goldenMicroProfileStatistic() *MicroProfileStatistic {
+	mps := NewMicroProfileStatistic()
+	mps.opCodeFrequency[PUSH1] = 12
+	mps.opCodeFrequency[ADD] = 3
+	mps.opCodeFrequency[SSTORE] = 1
+	mps.opCodeDuration[PUSH1] = 480
+	mps.opCodeDuration[ADD] = 90
+	mps.opCodeDuration[SSTORE] = 5100
+	mps.instructionFrequency[4] = 2
+	mps.instructionFrequency[1] = 7
+	mps.stepLengthFrequency[16] = 1
+	mps.stepLengthFrequency[3] = 2
+	mps.callDepthFrequency[1] = 3
+	mps.callDepthGas[1] = 21000
+	return mps
+}
+
+func TestMicroProfileDumpGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		dump   func(*MicroProfileStatistic, *bytes.Buffer) error
+	}{
+		{"testdata/microprofile.json", func(mps *MicroProfileStatistic, buf *bytes.Buffer) error { return mps.DumpJSON(buf) }},
+		{"testdata/microprofile.csv", func(mps *MicroProfileStatistic, buf *bytes.Buffer) error { return mps.DumpCSV(buf) }},
+	}
+	for _, tt := range tests {
+		want, err := ioutil.ReadFile(tt.golden)
+		if err != nil {
+			t.Fatalf("failed to read golden file: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tt.dump(goldenMicroProfileStatistic(), &buf); err != nil {
+			t.Fatalf("%s: dump failed: %v", tt.golden, err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("%s: output mismatch:\nhave:\n%s\nwant:\n%s", tt.golden, buf.Bytes(), want)
+		}
+	}
+}
+
+func TestMicroProfileStatisticReset(t *testing.T) {
+	mps := goldenMicroProfileStatistic()
+	mps.elapsed = time.Second
+	mps.Reset()
+
+	if len(mps.opCodeFrequency) != 0 {
+		t.Errorf("opcode frequency not empty: %v", mps.opCodeFrequency)
+	}
+	if len(mps.opCodeDuration) != 0 {
+		t.Errorf("opcode duration not empty: %v", mps.opCodeDuration)
+	}
+	if len(mps.instructionFrequency) != 0 {
+		t.Errorf("instruction frequency not empty: %v", mps.instructionFrequency)
+	}
+	if len(mps.stepLengthFrequency) != 0 {
+		t.Errorf("step-length frequency not empty: %v", mps.stepLengthFrequency)
+	}
+	if len(mps.callDepthFrequency) != 0 || len(mps.callDepthGas) != 0 {
+		t.Errorf("call-depth statistic not empty: %v, %v", mps.callDepthFrequency, mps.callDepthGas)
+	}
+	if mps.elapsed != 0 {
+		t.Errorf("elapsed time not reset: %v", mps.elapsed)
+	}
+
+	// the statistic must remain usable after a reset
+	mps.Merge(goldenMicroProfileStatistic())
+	if freq := mps.opCodeFrequency[PUSH1]; freq != 12 {
+		t.Errorf("PUSH1 frequency mismatch after reset: have %d, want %d", freq, 12)
+	}
+}
+
+func TestMicroProfileDurationSummary(t *testing.T) {
+	mps := goldenMicroProfileStatistic()
+	mps.opCodeDuration[MUL] = 100 // duration without recorded executions
+
+	want := []OpCodeDurationSummary{
+		{OpCode: SSTORE, Frequency: 1, Total: 5100, Mean: 5100},
+		{OpCode: PUSH1, Frequency: 12, Total: 480, Mean: 40},
+		{OpCode: ADD, Frequency: 3, Total: 90, Mean: 30},
+		{OpCode: MUL, Frequency: 0, Total: 100, Mean: 0},
+	}
+	have := mps.DurationSummary()
+	if len(have) != len(want) {
+		t.Fatalf("summary length mismatch: have %d, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if have[i] != want[i] {
+			t.Errorf("entry %d mismatch: have %+v, want %+v", i, have[i], want[i])
+		}
+	}
+}
+
+func TestMicroProfilingConcurrentCollectors(t *testing.T) {
+	const (
+		numCollectors = 2
+		numRecords    = 1000
+	)
+	oldChannel := mpChannel
+	mpChannel = make(chan *MicroProfileData, 16)
+	defer func() { mpChannel = oldChannel }()
+
+	// every collector owns its statistic
+	var (
+		dones = make([]chan struct{}, numCollectors)
+		stats = make([]*MicroProfileStatistic, numCollectors)
+	)
+	for i := 0; i < numCollectors; i++ {
+		dones[i] = make(chan struct{})
+		stats[i] = NewMicroProfileStatistic()
+		go MicroProfilingCollector(dones[i], stats[i])
+	}
+	for i := 0; i < numRecords; i++ {
+		ProcessMicroProfileData(&MicroProfileData{
+			OpCodeFrequency:      map[OpCode]uint64{ADD: 1},
+			OpCodeDuration:       map[OpCode]time.Duration{ADD: 2},
+			InstructionFrequency: map[uint64]uint64{1: 1},
+			StepLength:           1,
+		})
+	}
+	StopMicroProfiling()
+
+	// merge the collectors' statistics once all are done
+	mps := NewMicroProfileStatistic()
+	for i := 0; i < numCollectors; i++ {
+		<-dones[i]
+		mps.Merge(stats[i])
+	}
+	if freq := mps.opCodeFrequency[ADD]; freq != numRecords {
+		t.Errorf("ADD frequency mismatch: have %d, want %d", freq, numRecords)
+	}
+	if duration := mps.opCodeDuration[ADD]; duration != 2*numRecords {
+		t.Errorf("ADD duration mismatch: have %d, want %d", duration, 2*numRecords)
+	}
+	if freq := mps.stepLengthFrequency[1]; freq != numRecords {
+		t.Errorf("step-length frequency mismatch: have %d, want %d", freq, numRecords)
+	}
+}
+
+func TestInitMicroProfiling(t *testing.T) {
+	oldChannel, oldSize := mpChannel, MicroProfilingBufferSize
+	defer func() { mpChannel, MicroProfilingBufferSize = oldChannel, oldSize }()
+
+	for _, size := range []int{0, 1, 1024} {
+		atomic.StoreUint64(&mpBlocked, 3)
+		InitMicroProfiling(size)
+		if have := MicroProfilingBlocked(); have != 0 {
+			t.Errorf("blocked count not reset: have %d, want 0", have)
+		}
+		if cap(mpChannel) != size {
+			t.Errorf("channel capacity mismatch: have %d, want %d", cap(mpChannel), size)
+		}
+		if MicroProfilingBufferSize != size {
+			t.Errorf("buffer size mismatch: have %d, want %d", MicroProfilingBufferSize, size)
+		}
+	}
+}
+
+// enableMicroProfiling turns micro-profiling on with a fresh channel of the
+// given buffer size. The returned function restores the previous setup.
+func enableMicroProfiling(bufferSize int) func() {
+	oldChannel, oldSize, oldProfiling := mpChannel, MicroProfilingBufferSize, MicroProfiling
+	InitMicroProfiling(bufferSize)
+	MicroProfiling = true
+	return func() { mpChannel, MicroProfilingBufferSize, MicroProfiling = oldChannel, oldSize, oldProfiling }
+}
+
+func TestMicroProfilingOpCodeGas(t *testing.T) {
+	defer enableMicroProfiling(1)()
+
+	// PUSH1 1, PUSH1 2, ADD, POP, STOP
+	if _, _, err := runTestCode(t, hexutil.MustDecode("0x60016002015000"), nil, 100000, params.AllEthashProtocolChanges, Config{}); err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+
+	mps := NewMicroProfileStatistic()
+	mps.update(<-mpChannel)
+	want := map[OpCode]uint64{
+		PUSH1: 2 * GasFastestStep,
+		ADD:   GasFastestStep,
+		POP:   GasQuickStep,
+		STOP:  0,
+	}
+	if len(mps.opCodeGas) != len(want) {
+		t.Fatalf("opcode gas size mismatch: have %v, want %v", mps.opCodeGas, want)
+	}
+	for opCode, gas := range want {
+		if have := mps.opCodeGas[opCode]; have != gas {
+			t.Errorf("%v: gas mismatch: have %d, want %d", opCode, have, gas)
+		}
+	}
+}
+
+func TestMicroProfilingOpCodeGasCall(t *testing.T) {
+	defer enableMicroProfiling(2)()
+
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"succeeding callee", selfCallCode},
+		// selfCallCode with a STOP after the call and an INVALID for the
+		// callee, so that the callee burns its gas while the caller succeeds
+		{"failing callee", "0x6000358015601e576001900360005260006000602060006000305af150005bfe"},
+	}
+	for _, tt := range tests {
+		// a single nested call
+		const gas = 1000000
+		input := common.LeftPadBytes([]byte{1}, 32)
+		_, leftOver, err := runTestCode(t, hexutil.MustDecode(tt.code), input, gas, params.AllEthashProtocolChanges, Config{})
+		if err != nil {
+			t.Fatalf("%s: execution failed: %v", tt.name, err)
+		}
+
+		mps := NewMicroProfileStatistic()
+		mps.update(<-mpChannel)
+		mps.update(<-mpChannel)
+
+		// the called account is cold; the forwarded gas is not part of CALL
+		if have, want := mps.opCodeGas[CALL], params.ColdAccountAccessCostEIP2929; have != want {
+			t.Errorf("%s: CALL gas mismatch: have %d, want %d", tt.name, have, want)
+		}
+		// each unit of gas is charged to exactly one opcode
+		var total uint64
+		for _, gas := range mps.opCodeGas {
+			total += gas
+		}
+		if used := gas - leftOver; total != used {
+			t.Errorf("%s: opcode gas sum mismatch: have %d, want %d", tt.name, total, used)
+		}
+	}
+}
+
+func TestMicroProfilingCallDepth(t *testing.T) {
+	const depth = 4
+
+	defer enableMicroProfiling(depth)()
+
+	input := common.LeftPadBytes([]byte{depth - 1}, 32)
+	if _, _, err := runTestCode(t, hexutil.MustDecode(selfCallCode), input, 1000000, params.AllEthashProtocolChanges, Config{}); err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+
+	mps := NewMicroProfileStatistic()
+	for i := 0; i < depth; i++ {
+		mps.update(<-mpChannel)
+	}
+	if len(mps.callDepthFrequency) != depth {
+		t.Fatalf("call depth size mismatch: have %v, want %d depths", mps.callDepthFrequency, depth)
+	}
+	for d := 1; d <= depth; d++ {
+		if freq := mps.callDepthFrequency[d]; freq != 1 {
+			t.Errorf("depth %d: frequency mismatch: have %d, want 1", d, freq)
+		}
+		if mps.callDepthGas[d] == 0 {
+			t.Errorf("depth %d: no gas recorded", d)
+		}
+		// the gas of a frame includes the gas of its nested calls
+		if d > 1 && mps.callDepthGas[d] >= mps.callDepthGas[d-1] {
+			t.Errorf("depth %d: gas %d not below gas %d of depth %d", d, mps.callDepthGas[d], mps.callDepthGas[d-1], d-1)
+		}
+	}
+
+	path, cleanup := microProfilingTestDB(t)
+	defer cleanup()
+	mps.Dump(path, "test")
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		frames uint64
+		gas    uint64
+	)
+	if err := db.QueryRow("SELECT frequency, gas FROM CallDepth WHERE depth = 1").Scan(&frames, &gas); err != nil {
+		t.Fatalf("failed to query call depth: %v", err)
+	}
+	if frames != 1 || gas != mps.callDepthGas[1] {
+		t.Errorf("call depth row mismatch: have (%d, %d), want (1, %d)", frames, gas, mps.callDepthGas[1])
+	}
+}
+
+// TestMicroProfilingCallDepthGasFailed checks that the gas of a frame is the
+// gas its caller is charged, also when the frame fails.
+func TestMicroProfilingCallDepthGasFailed(t *testing.T) {
+	defer enableMicroProfiling(1)()
+
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"stop", "0x600000"},            // PUSH1 0, STOP
+		{"revert", "0x60006000fd"},      // PUSH1 0, PUSH1 0, REVERT
+		{"invalid", "0x6000fe"},         // PUSH1 0, INVALID
+		{"stack underflow", "0x600001"}, // PUSH1 0, ADD
+	}
+	for _, tt := range tests {
+		const gas = 100000
+		_, leftOver, _ := runTestCode(t, hexutil.MustDecode(tt.code), nil, gas, params.AllEthashProtocolChanges, Config{})
+		if have, want := (<-mpChannel).Gas, gas-leftOver; have != want {
+			t.Errorf("%s: gas mismatch: have %d, want %d", tt.name, have, want)
+		}
+	}
+}
+
+// dumpedRows returns the rows of a two-column table in insertion order.
+func dumpedRows(t *testing.T, path string, query string) [][2]string {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatalf("failed to query %q: %v", query, err)
+	}
+	defer rows.Close()
+
+	var have [][2]string
+	for rows.Next() {
+		var row [2]string
+		if err := rows.Scan(&row[0], &row[1]); err != nil {
+			t.Fatalf("failed to scan row: %v", err)
+		}
+		have = append(have, row)
+	}
+	return have
+}
+
+func TestMicroProfileDumpDeterministic(t *testing.T) {
+	mps := NewMicroProfileStatistic()
+	for op := range opCodeToString {
+		mps.opCodeFrequency[op] = uint64(op) + 1
+	}
+	for i := uint64(0); i < 256; i++ {
+		mps.instructionFrequency[i] = i + 1
+	}
+
+	queries := []string{
+		"SELECT opcode, frequency FROM OpCodeFrequency ORDER BY rowid",
+		"SELECT instructions, frequency FROM InstructionFrequency ORDER BY rowid",
+	}
+	var dumps [2][][][2]string
+	for i := range dumps {
+		path, cleanup := microProfilingTestDB(t)
+		defer cleanup()
+		mps.Dump(path, "test")
+		for _, query := range queries {
+			dumps[i] = append(dumps[i], dumpedRows(t, path, query))
+		}
+	}
+	for i, query := range queries {
+		for j := range dumps[0][i] {
+			if dumps[0][i][j] != dumps[1][i][j] {
+				t.Fatalf("%q: row %d differs between dumps: %v != %v", query, j, dumps[0][i][j], dumps[1][i][j])
+			}
+		}
+	}
+	// rows are ordered by the numeric value of their keys
+	if len(dumps[0][0]) != len(mps.opCodeFrequency) || len(dumps[0][1]) != len(mps.instructionFrequency) {
+		t.Fatalf("row count mismatch: have %d and %d, want %d and %d", len(dumps[0][0]), len(dumps[0][1]), len(mps.opCodeFrequency), len(mps.instructionFrequency))
+	}
+	for j, op := range sortedOpCodes(mps.opCodeFrequency) {
+		if have, want := dumps[0][0][j][0], op.String(); have != want {
+			t.Errorf("opcode row %d: have %q, want %q", j, have, want)
+		}
+	}
+	for j, row := range dumps[0][1] {
+		if want := strconv.Itoa(j); row[0] != want {
+			t.Errorf("instruction row %d: have %s, want %s", j, row[0], want)
+		}
+	}
+}
+
+func TestMicroProfileDumpOpCodeNames(t *testing.T) {
+	path, cleanup := microProfilingTestDB(t)
+	defer cleanup()
+
+	mps := NewMicroProfileStatistic()
+	mps.opCodeFrequency[PUSH1] = 2
+	mps.opCodeFrequency[OpCode(0x0c)] = 1 // undefined opcode
+	mps.opCodeDuration[PUSH1] = 100
+	mps.opCodeGas[PUSH1] = 6
+	mps.Dump(path, "test")
+
+	tests := []struct {
+		query string
+		want  [][2]string
+	}{
+		{"SELECT opcode, frequency FROM OpCodeFrequency ORDER BY rowid", [][2]string{{"opcode 0xc not defined", "1"}, {"PUSH1", "2"}}},
+		{"SELECT opcode, duration FROM OpCodeDuration ORDER BY rowid", [][2]string{{"PUSH1", "100"}}},
+		{"SELECT opcode, gas FROM OpCodeGas ORDER BY rowid", [][2]string{{"PUSH1", "6"}}},
+	}
+	for _, tt := range tests {
+		have := dumpedRows(t, path, tt.query)
+		if len(have) != len(tt.want) {
+			t.Fatalf("%q: rows mismatch: have %v, want %v", tt.query, have, tt.want)
+		}
+		for i := range tt.want {
+			if have[i] != tt.want[i] {
+				t.Errorf("%q: row %d mismatch: have %v, want %v", tt.query, i, have[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestMicroProfilingThroughput(t *testing.T) {
+	defer enableMicroProfiling(1)()
+
+	// Count down from 200:
+	//   PUSH1 200, JUMPDEST, PUSH1 1, SWAP1, SUB, DUP1, PUSH1 2, JUMPI, STOP
+	if _, _, err := runTestCode(t, hexutil.MustDecode("0x60c85b600190038060025700"), nil, 1000000, params.AllEthashProtocolChanges, Config{}); err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+
+	mps := NewMicroProfileStatistic()
+	mps.update(<-mpChannel)
+	if mps.Elapsed() <= 0 {
+		t.Errorf("no elapsed time recorded: have %v", mps.Elapsed())
+	}
+	if have, want := mps.Instructions(), uint64(1+200*7+1); have != want {
+		t.Errorf("instructions mismatch: have %d, want %d", have, want)
+	}
+	if mps.InstructionsPerSecond() <= 0 {
+		t.Errorf("no throughput computed: have %v", mps.InstructionsPerSecond())
+	}
+
+	// nested invocations are part of the wall time of their top-level call
+	nested := NewMicroProfileStatistic()
+	nested.update(&MicroProfileData{StepLength: 10, CallDepth: 2, Elapsed: time.Second})
+	if nested.Elapsed() != 0 {
+		t.Errorf("nested call counted as top-level: have %v, want 0", nested.Elapsed())
+	}
+	mps.Merge(nested)
+	if have, want := mps.Instructions(), uint64(1+200*7+1+10); have != want {
+		t.Errorf("merged instructions mismatch: have %d, want %d", have, want)
+	}
+
+	path, cleanup := microProfilingTestDB(t)
+	defer cleanup()
+	mps.Dump(path, "test")
+	rows := dumpedRows(t, path, "SELECT elapsed, instructions FROM Throughput")
+	if len(rows) != 1 {
+		t.Fatalf("throughput rows mismatch: have %v, want a single row", rows)
+	}
+	if want := [2]string{strconv.FormatInt(int64(mps.Elapsed()), 10), "1412"}; rows[0] != want {
+		t.Errorf("throughput row mismatch: have %v, want %v", rows[0], want)
+	}
+}
+
+func TestMicroProfileUnusedOpcodes(t *testing.T) {
+	missing := []OpCode{STOP, SSTORE, SELFDESTRUCT}
+
+	mps := NewMicroProfileStatistic()
+	for opCode := range opCodeToString {
+		mps.opCodeFrequency[opCode] = 1
+	}
+	for _, opCode := range missing {
+		delete(mps.opCodeFrequency, opCode)
+	}
+	// executed undefined opcodes do not count towards the coverage
+	mps.opCodeFrequency[OpCode(0x0c)] = 1
+
+	if have := mps.UnusedOpcodes(); !reflect.DeepEqual(have, missing) {
+		t.Errorf("unused opcodes mismatch: have %v, want %v", have, missing)
+	}
+	want := 100 * float64(len(opCodeToString)-len(missing)) / float64(len(opCodeToString))
+	if have := mps.OpCodeCoverage(); have != want {
+		t.Errorf("coverage mismatch: have %v, want %v", have, want)
+	}
+
+	empty := NewMicroProfileStatistic()
+	if have := len(empty.UnusedOpcodes()); have != len(opCodeToString) {
+		t.Errorf("unused opcodes of empty statistic: have %d, want %d", have, len(opCodeToString))
+	}
+	if have := empty.OpCodeCoverage(); have != 0 {
+		t.Errorf("coverage of empty statistic: have %v, want 0", have)
+	}
+}
+
+func TestMicroProfilingBackpressure(t *testing.T) {
+	oldChannel := mpChannel
+	mpChannel = make(chan *MicroProfileData, 1)
+	defer func() { mpChannel = oldChannel }()
+
+	blocked := MicroProfilingBlocked()
+	ProcessMicroProfileData(&MicroProfileData{})
+	if have := MicroProfilingBlocked(); have != blocked {
+		t.Fatalf("blocked counter changed without a full queue: have %d, want %d", have, blocked)
+	}
+	if have := MicroProfilingQueueDepth(); have != 1 {
+		t.Fatalf("queue depth mismatch: have %d, want 1", have)
+	}
+
+	// the queue is full, so the next producer must block
+	done := make(chan struct{})
+	go func() {
+		ProcessMicroProfileData(&MicroProfileData{})
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for MicroProfilingBlocked() != blocked+1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("blocked producer not counted: have %d, want %d", MicroProfilingBlocked(), blocked+1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-mpChannel
+	<-done
+	if have := MicroProfilingQueueDepth(); have != 1 {
+		t.Errorf("queue depth mismatch: have %d, want 1", have)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2022 The go-fantom Authors
+// This file is part of the go-fantom library.
+//
+// The go-fantom library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/golang/mock/gomock"
+	"github.com/holiman/uint256"
+)
+
+// expectColdSload registers the state accesses of an SLOAD on a slot that
+// is not yet part of the access list: a lookup followed by an insertion.
+func expectColdSload(mock *MockStateDB, addr common.Address, slot common.Hash) {
+	gomock.InOrder(
+		mock.EXPECT().SlotInAccessList(addr, slot).Return(true, false),
+		mock.EXPECT().AddSlotToAccessList(addr, slot),
+	)
+}
+
+// expectWarmSload registers the state accesses of an SLOAD on a slot that
+// is already part of the access list: a lookup only.
+func expectWarmSload(mock *MockStateDB, addr common.Address, slot common.Hash) {
+	mock.EXPECT().SlotInAccessList(addr, slot).Return(true, true)
+}
+
+func TestGasSLoadEIP2929(t *testing.T) {
+	var (
+		addr = common.HexToAddress("0xc0ffee")
+		slot = common.HexToHash("0x01")
+	)
+	tests := []struct {
+		expect func(*MockStateDB, common.Address, common.Hash)
+		cost   uint64
+	}{
+		{expectColdSload, params.ColdSloadCostEIP2929},
+		{expectWarmSload, params.WarmStorageReadCostEIP2929},
+	}
+	for i, tt := range tests {
+		ctrl := gomock.NewController(t)
+		mock := NewMockStateDB(ctrl)
+		tt.expect(mock, addr, slot)
+
+		evm := &EVM{StateDB: mock}
+		contract := NewContract(AccountRef(common.Address{}), AccountRef(addr), new(big.Int), 100000)
+		stack := newstack()
+		stack.push(new(uint256.Int).SetBytes(slot.Bytes()))
+
+		cost, err := gasSLoadEIP2929(evm, contract, stack, NewMemory(), 0)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+		}
+		if cost != tt.cost {
+			t.Errorf("test %d: gas cost mismatch: have %d, want %d", i, cost, tt.cost)
+		}
+		returnStack(stack)
+		ctrl.Finish()
+	}
+}
+
+func TestGasSLoadEIP2929ColdThenWarm(t *testing.T) {
+	var (
+		addr = common.HexToAddress("0xc0ffee")
+		slot = common.HexToHash("0x01")
+	)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mock := NewMockStateDB(ctrl)
+	expectColdSload(mock, addr, slot)
+	expectWarmSload(mock, addr, slot)
+
+	evm := &EVM{StateDB: mock}
+	contract := NewContract(AccountRef(common.Address{}), AccountRef(addr), new(big.Int), 100000)
+	want := []uint64{params.ColdSloadCostEIP2929, params.WarmStorageReadCostEIP2929}
+	for i, cost := range want {
+		stack := newstack()
+		stack.push(new(uint256.Int).SetBytes(slot.Bytes()))
+		have, err := gasSLoadEIP2929(evm, contract, stack, NewMemory(), 0)
+		if err != nil {
+			t.Errorf("access %d: unexpected error: %v", i, err)
+		}
+		if have != cost {
+			t.Errorf("access %d: gas cost mismatch: have %d, want %d", i, have, cost)
+		}
+		returnStack(stack)
+	}
+}
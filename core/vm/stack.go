@@ -29,20 +29,46 @@ var stackPool = sync.Pool{
 	},
 }
 
+// stackPoolEnabled reports whether stacks are recycled through stackPool.
+var stackPoolEnabled = true
+
+// SetStackPoolEnabled enables or disables the recycling of stacks. With
+// pooling disabled every execution allocates a fresh stack, which makes
+// allocations deterministic for benchmarks. It must not be called while
+// contracts are being executed.
+func SetStackPoolEnabled(enabled bool) {
+	stackPoolEnabled = enabled
+}
+
 // Stack is an object for basic stack operations. Items popped to the stack are
 // expected to be changed and modified. stack does not take care of adding newly
 // initialised objects.
 type Stack struct {
 	data []uint256.Int
+	hwm  int // maximum length reached since the stack was handed out
 }
 
 func newstack() *Stack {
+	if !stackPoolEnabled {
+		return &Stack{data: make([]uint256.Int, 0, 16)}
+	}
 	return stackPool.Get().(*Stack)
 }
 
 func returnStack(s *Stack) {
+	// Clear every slot the previous execution has written, including popped
+	// ones above the current length, so no values leak into the next user of
+	// the stack. Slots above the high-water mark are still zero. The loop is
+	// compiled into a single memclr.
+	data := s.data[:s.hwm]
+	for i := range data {
+		data[i] = uint256.Int{}
+	}
 	s.data = s.data[:0]
-	stackPool.Put(s)
+	s.hwm = 0
+	if stackPoolEnabled {
+		stackPool.Put(s)
+	}
 }
 
 // Data returns the underlying uint256.Int array.
@@ -53,10 +79,17 @@ func (st *Stack) Data() []uint256.Int {
 func (st *Stack) push(d *uint256.Int) {
 	// NOTE push limit (1024) is checked in baseCheck
 	st.data = append(st.data, *d)
+	if len(st.data) > st.hwm {
+		st.hwm = len(st.data)
+	}
 }
+
 func (st *Stack) pushN(ds ...uint256.Int) {
 	// FIXME: Is there a way to pass args by pointers.
 	st.data = append(st.data, ds...)
+	if len(st.data) > st.hwm {
+		st.hwm = len(st.data)
+	}
 }
 
 func (st *Stack) pop() (ret uint256.Int) {
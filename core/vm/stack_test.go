@@ -0,0 +1,123 @@
+// Copyright 2022 The go-fantom Authors
+// This file is part of the go-fantom library.
+//
+// The go-fantom library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/holiman/uint256"
+)
+
+func TestReturnStackResets(t *testing.T) {
+	stack := newstack()
+	for i := uint64(0); i < 10; i++ {
+		stack.push(uint256.NewInt(i))
+	}
+	returnStack(stack)
+	if stack.len() != 0 {
+		t.Errorf("stack not reset: have length %d, want 0", stack.len())
+	}
+}
+
+func TestStackPoolDisabled(t *testing.T) {
+	SetStackPoolEnabled(false)
+	defer SetStackPoolEnabled(true)
+
+	for i := 0; i < 10; i++ {
+		stack := newstack()
+		if stack.len() != 0 {
+			t.Fatalf("new stack not empty: have length %d", stack.len())
+		}
+		stack.push(uint256.NewInt(1))
+		returnStack(stack)
+		if next := newstack(); next == stack {
+			t.Fatalf("stack reused with pooling disabled")
+		}
+	}
+}
+
+func TestReturnStackClearsSlots(t *testing.T) {
+	stack := newstack()
+	for i := uint64(1); i <= 32; i++ {
+		stack.push(uint256.NewInt(i))
+	}
+	// Popped slots stay in the backing array above the length.
+	for i := 0; i < 16; i++ {
+		stack.pop()
+	}
+	returnStack(stack)
+	for i, v := range stack.data[:cap(stack.data)] {
+		if !v.IsZero() {
+			t.Fatalf("slot %d not cleared: have %v, want 0", i, &v)
+		}
+	}
+}
+
+func TestReturnStackClearsAfterDeepUse(t *testing.T) {
+	SetStackPoolEnabled(false)
+	defer SetStackPoolEnabled(true)
+
+	// grow the stack, then reuse it for a shallow execution
+	stack := newstack()
+	for i := uint64(1); i <= 1024; i++ {
+		stack.push(uint256.NewInt(i))
+	}
+	returnStack(stack)
+	stack.pushN(*uint256.NewInt(1), *uint256.NewInt(2), *uint256.NewInt(3))
+	stack.pop()
+	stack.pop()
+	returnStack(stack)
+
+	for i, v := range stack.data[:cap(stack.data)] {
+		if !v.IsZero() {
+			t.Fatalf("slot %d not cleared: have %v, want 0", i, &v)
+		}
+	}
+}
+
+func BenchmarkReturnStack(b *testing.B) {
+	value := uint256.NewInt(0xff)
+	for _, depth := range []int{16, 128, 1024} {
+		b.Run(fmt.Sprintf("depth-%d", depth), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				stack := newstack()
+				for j := 0; j < depth; j++ {
+					stack.push(value)
+				}
+				returnStack(stack)
+			}
+		})
+	}
+	// a shallow call frame on a stack grown by an earlier deep one
+	b.Run("shallow-after-deep", func(b *testing.B) {
+		SetStackPoolEnabled(false)
+		defer SetStackPoolEnabled(true)
+
+		stack := newstack()
+		for j := 0; j < 1024; j++ {
+			stack.push(value)
+		}
+		returnStack(stack)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			stack.push(value)
+			stack.push(value)
+			returnStack(stack)
+		}
+	})
+}
@@ -1,6 +1,13 @@
 package discfilter
 
 import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
 	lru "github.com/hashicorp/golang-lru"
 
 	"github.com/ethereum/go-ethereum/p2p/enode"
@@ -10,18 +17,114 @@ import (
 var (
 	enabled    = false
 	dynamic, _ = lru.New(50000)
+	staticKeys = []string{"eth", "eth2"}
 )
 
 func Enable() {
 	enabled = true
 }
 
+// EnableWithBanFile loads the dynamic ban list from the given file and
+// enables the filter. A missing file is not an error, as it is only created
+// by the first SaveBans; any other failure leaves the filter disabled.
+func EnableWithBanFile(path string) error {
+	if err := LoadBans(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	Enable()
+	return nil
+}
+
+// SetStaticBanKeys sets the ENR keys which statically ban any record
+// containing one of them. It must be called before Enable.
+func SetStaticBanKeys(keys []string) {
+	staticKeys = append([]string(nil), keys...)
+}
+
+// SetDynamicCapacity sets the maximum number of nodes in the dynamic ban
+// list. If the list holds more nodes, the least recently banned ones are
+// dropped.
+func SetDynamicCapacity(n int) error {
+	if n <= 0 {
+		return errors.New("dynamic ban list capacity must be positive")
+	}
+	dynamic.Resize(n)
+	return nil
+}
+
 func Ban(id enode.ID) {
 	if enabled {
 		dynamic.Add(id, struct{}{})
 	}
 }
 
+// Unban removes the node from the dynamic ban list.
+func Unban(id enode.ID) {
+	dynamic.Remove(id)
+}
+
+// BannedCount returns the number of nodes in the dynamic ban list.
+func BannedCount() int {
+	return dynamic.Len()
+}
+
+// LoadBans adds the node IDs stored in the given file, one hex ID per line,
+// to the dynamic ban list.
+func LoadBans(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		id, err := enode.ParseID(line)
+		if err != nil {
+			return err
+		}
+		dynamic.Add(id, struct{}{})
+	}
+	return scanner.Err()
+}
+
+// SaveBans writes the dynamic ban list to the given file, one hex ID per
+// line, from the least to the most recently banned node. The list is written
+// to a temporary file which then replaces the target, so that an interrupted
+// write never leaves a truncated list behind.
+func SaveBans(path string) error {
+	var sb strings.Builder
+	for _, key := range dynamic.Keys() {
+		sb.WriteString(key.(enode.ID).String())
+		sb.WriteByte('\n')
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(sb.String()); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
 func BannedDynamic(id enode.ID) bool {
 	if !enabled {
 		return false
@@ -33,7 +136,12 @@ func BannedStatic(rec *enr.Record) bool {
 	if !enabled {
 		return false
 	}
-	return rec.Has("eth") || rec.Has("eth2")
+	for _, key := range staticKeys {
+		if rec.Has(key) {
+			return true
+		}
+	}
+	return false
 }
 
 func Banned(id enode.ID, rec *enr.Record) bool {
@@ -0,0 +1,259 @@
+package discfilter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+// resetDynamic empties the dynamic ban list and enables the filter. The
+// returned function empties the list again and restores the filter state.
+func resetDynamic() func() {
+	oldEnabled := enabled
+	enabled = true
+	dynamic.Purge()
+	return func() {
+		dynamic.Purge()
+		enabled = oldEnabled
+	}
+}
+
+func TestSaveLoadBans(t *testing.T) {
+	defer resetDynamic()()
+
+	dir, err := ioutil.TempDir("", "discfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bans")
+
+	ids := []enode.ID{{1}, {2}, {3}}
+	for _, id := range ids {
+		Ban(id)
+	}
+	if err := SaveBans(path); err != nil {
+		t.Fatalf("failed to save bans: %v", err)
+	}
+
+	// simulate a restart
+	dynamic.Purge()
+	if BannedDynamic(ids[0]) {
+		t.Fatalf("ban list not cleared")
+	}
+	if err := LoadBans(path); err != nil {
+		t.Fatalf("failed to load bans: %v", err)
+	}
+	for _, id := range ids {
+		if !BannedDynamic(id) {
+			t.Errorf("node %v not banned after reload", id)
+		}
+	}
+	if BannedDynamic(enode.ID{4}) {
+		t.Errorf("unbanned node reported as banned")
+	}
+}
+
+func TestSaveBansReplaces(t *testing.T) {
+	defer resetDynamic()()
+
+	dir, err := ioutil.TempDir("", "discfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bans")
+
+	Ban(enode.ID{1})
+	Ban(enode.ID{2})
+	if err := SaveBans(path); err != nil {
+		t.Fatalf("failed to save bans: %v", err)
+	}
+	dynamic.Purge()
+	Ban(enode.ID{3})
+	if err := SaveBans(path); err != nil {
+		t.Fatalf("failed to save bans: %v", err)
+	}
+
+	// the second list replaces the first and no temporary file is left
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "bans" {
+		t.Fatalf("unexpected files in directory: %v", files)
+	}
+	dynamic.Purge()
+	if err := LoadBans(path); err != nil {
+		t.Fatalf("failed to load bans: %v", err)
+	}
+	if BannedDynamic(enode.ID{1}) || !BannedDynamic(enode.ID{3}) {
+		t.Errorf("ban list not replaced: have %v", dynamic.Keys())
+	}
+}
+
+func TestLoadBansInvalid(t *testing.T) {
+	defer resetDynamic()()
+
+	dir, err := ioutil.TempDir("", "discfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bans")
+
+	if err := LoadBans(path); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+	if err := ioutil.WriteFile(path, []byte("not an id\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadBans(path); err == nil {
+		t.Errorf("expected error for malformed file")
+	}
+}
+
+func TestEnableWithBanFile(t *testing.T) {
+	defer resetDynamic()()
+
+	dir, err := ioutil.TempDir("", "discfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bans")
+
+	// the ban file does not exist before the first save
+	enabled = false
+	if err := EnableWithBanFile(path); err != nil {
+		t.Fatalf("failed to enable without ban file: %v", err)
+	}
+	if !enabled {
+		t.Fatalf("filter not enabled")
+	}
+
+	Ban(enode.ID{1})
+	if err := SaveBans(path); err != nil {
+		t.Fatalf("failed to save bans: %v", err)
+	}
+
+	// simulate a restart
+	enabled = false
+	dynamic.Purge()
+	if err := EnableWithBanFile(path); err != nil {
+		t.Fatalf("failed to enable with ban file: %v", err)
+	}
+	if !BannedDynamic(enode.ID{1}) {
+		t.Errorf("node not banned after enabling with ban file")
+	}
+
+	// a malformed file leaves the filter disabled
+	enabled = false
+	if err := ioutil.WriteFile(path, []byte("not an id\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnableWithBanFile(path); err == nil {
+		t.Errorf("expected error for malformed file")
+	}
+	if enabled {
+		t.Errorf("filter enabled despite malformed file")
+	}
+}
+
+func TestUnban(t *testing.T) {
+	defer resetDynamic()()
+
+	a, b := enode.ID{1}, enode.ID{2}
+	Ban(a)
+	Ban(b)
+	if count := BannedCount(); count != 2 {
+		t.Fatalf("ban count mismatch: have %d, want %d", count, 2)
+	}
+
+	Unban(a)
+	if BannedDynamic(a) {
+		t.Errorf("node %v still banned after unban", a)
+	}
+	if !BannedDynamic(b) {
+		t.Errorf("node %v unbanned by unrelated unban", b)
+	}
+	if count := BannedCount(); count != 1 {
+		t.Errorf("ban count mismatch: have %d, want %d", count, 1)
+	}
+
+	// unbanning an unknown node is a no-op
+	Unban(enode.ID{3})
+	if count := BannedCount(); count != 1 {
+		t.Errorf("ban count mismatch: have %d, want %d", count, 1)
+	}
+}
+
+func TestStaticBanKeys(t *testing.T) {
+	defer resetDynamic()()
+	defer SetStaticBanKeys([]string{"eth", "eth2"})
+
+	record := func(key string) *enr.Record {
+		var r enr.Record
+		r.Set(enr.WithEntry(key, uint(1)))
+		return &r
+	}
+
+	// default keys
+	if !BannedStatic(record("eth")) || !BannedStatic(record("eth2")) {
+		t.Errorf("default keys not banned")
+	}
+	if BannedStatic(record("opera")) {
+		t.Errorf("record without banned key reported as banned")
+	}
+
+	SetStaticBanKeys([]string{"opera", "les"})
+	if !BannedStatic(record("opera")) || !BannedStatic(record("les")) {
+		t.Errorf("custom keys not banned")
+	}
+	if BannedStatic(record("eth")) {
+		t.Errorf("replaced default key still banned")
+	}
+
+	SetStaticBanKeys(nil)
+	if BannedStatic(record("eth")) {
+		t.Errorf("record banned without any static keys")
+	}
+}
+
+func TestSetDynamicCapacity(t *testing.T) {
+	defer resetDynamic()()
+	defer SetDynamicCapacity(50000)
+
+	if err := SetDynamicCapacity(0); err == nil {
+		t.Errorf("expected error for zero capacity")
+	}
+	for i := byte(0); i < 5; i++ {
+		Ban(enode.ID{i})
+	}
+
+	// shrinking keeps the most recently banned nodes
+	if err := SetDynamicCapacity(3); err != nil {
+		t.Fatalf("failed to set capacity: %v", err)
+	}
+	if count := BannedCount(); count != 3 {
+		t.Fatalf("ban count mismatch: have %d, want %d", count, 3)
+	}
+	for i := byte(0); i < 5; i++ {
+		if want := i >= 2; BannedDynamic(enode.ID{i}) != want {
+			t.Errorf("node %d: banned mismatch: have %v, want %v", i, !want, want)
+		}
+	}
+
+	// further bans evict at the new limit
+	Ban(enode.ID{5})
+	if count := BannedCount(); count != 3 {
+		t.Errorf("ban count mismatch: have %d, want %d", count, 3)
+	}
+	if BannedDynamic(enode.ID{2}) {
+		t.Errorf("least recently banned node not evicted")
+	}
+}